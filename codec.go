@@ -0,0 +1,27 @@
+package httpstream
+
+import "github.com/nativebpm/httpstream/internal/httpcodec"
+
+// Codec encodes request bodies and decodes response bodies of one media
+// type, streaming to and from the body. Implement it to plug in formats such
+// as CBOR or MessagePack, or a faster JSON engine.
+type Codec = httpcodec.Codec
+
+// JSONCodec is the Codec for application/json based on encoding/json.
+type JSONCodec = httpcodec.JSON
+
+// XMLCodec is the Codec for application/xml based on encoding/xml. It also
+// decodes text/xml and media types with the +xml suffix. Set Prolog to
+// xml.Header to write an XML declaration before each value.
+type XMLCodec = httpcodec.XML
+
+// CodecRegistry maps media types to codecs. Media types with a structured
+// syntax suffix, such as application/problem+json, fall back to the codec
+// of the suffix. A nil *CodecRegistry knows only JSON.
+type CodecRegistry = httpcodec.Registry
+
+// NewCodecRegistry creates a CodecRegistry holding codecs, each registered
+// under the media type of its ContentType.
+func NewCodecRegistry(codecs ...Codec) *CodecRegistry {
+	return httpcodec.NewRegistry(codecs...)
+}
@@ -0,0 +1,77 @@
+package httpstream
+
+import (
+	"net/http"
+
+	"github.com/nativebpm/httpstream/internal/httpresponse"
+)
+
+// decoder is implemented by Request and Multipart.
+type decoder interface {
+	Decode(v any) error
+}
+
+// Do sends req and stream-decodes its JSON response body into a new T,
+// closing the body. See Request.Decode for how errors are reported.
+func Do[T any](req decoder) (T, error) {
+	var v T
+	err := req.Decode(&v)
+	return v, err
+}
+
+// DecodeJSON stream-decodes the JSON body of resp into v and closes the
+// body. It fails with a *DecodeError when the Content-Type is not JSON or
+// the body cannot be decoded.
+func DecodeJSON(resp *http.Response, v any) error {
+	return httpresponse.DecodeJSON(resp, v)
+}
+
+// DecodeWith stream-decodes the body of resp into v with codec and closes
+// the body. It fails with a *DecodeError when the codec does not accept the
+// Content-Type or the body cannot be decoded.
+func DecodeWith(resp *http.Response, codec Codec, v any) error {
+	return httpresponse.DecodeWith(resp, codec, v)
+}
+
+// Decode stream-decodes the body of resp into v with the codec registered
+// in codecs for its Content-Type and closes the body. A nil registry
+// decodes JSON only.
+func Decode(resp *http.Response, codecs *CodecRegistry, v any) error {
+	return httpresponse.Decode(resp, codecs, v)
+}
+
+// DecodeLines returns an iterator over the records of a newline-delimited
+// JSON response body, decoded one at a time. Blank lines are skipped, decode
+// errors carry their line number, and the body is closed when the iteration
+// ends. With Go 1.23 and later the iterator can be used with range:
+//
+//	for event, err := range httpstream.DecodeLines[Event](resp) {
+//		...
+//	}
+func DecodeLines[T any](resp *http.Response) func(yield func(T, error) bool) {
+	return httpresponse.DecodeLines[T](resp)
+}
+
+// DecodeArray returns an iterator over the elements of a JSON array in the
+// response body, decoded one at a time without loading the whole array.
+// The array is the top-level value when path is empty, or is found at a
+// dot-separated path of object keys such as "data.items". The body is
+// closed when the iteration ends.
+func DecodeArray[T any](resp *http.Response, path string) func(yield func(T, error) bool) {
+	return httpresponse.DecodeArray[T](resp, path)
+}
+
+// DecodeXML stream-decodes the XML body of resp into v and closes the body.
+// It fails with a *DecodeError when the Content-Type is not XML or the body
+// cannot be decoded.
+func DecodeXML(resp *http.Response, v any) error {
+	return httpresponse.DecodeXML(resp, v)
+}
+
+// DecodeXMLElements returns an iterator over the elements with local name
+// name in the XML body of resp, decoded one at a time while the body is
+// read token by token, so large feeds are never loaded whole. The body is
+// closed when the iteration ends.
+func DecodeXMLElements[T any](resp *http.Response, name string) func(yield func(T, error) bool) {
+	return httpresponse.DecodeXMLElements[T](resp, name)
+}
@@ -0,0 +1,36 @@
+package httpstream
+
+import (
+	"github.com/nativebpm/httpstream/internal/httprequest"
+	"github.com/nativebpm/httpstream/internal/httpresponse"
+)
+
+// ErrUnexpectedContentType reports a response whose Content-Type does not
+// match the decoder. It is wrapped by DecodeError.
+var ErrUnexpectedContentType = httpresponse.ErrUnexpectedContentType
+
+// StatusError is returned by Send when ExpectStatus or ExpectSuccess is set
+// and the response status is not expected. It carries the method, URL,
+// status, headers and the first bytes of the body; use errors.As to get it.
+// Problem+json responses are also available as a *Problem.
+type StatusError = httpresponse.StatusError
+
+// Problem is an RFC 9457 problem details document decoded from an
+// application/problem+json response. It is wrapped by StatusError.
+type Problem = httpresponse.Problem
+
+// ProblemRegistry maps problem type URIs to domain errors.
+type ProblemRegistry = httpresponse.ProblemRegistry
+
+// NewProblemRegistry creates an empty ProblemRegistry.
+func NewProblemRegistry() *ProblemRegistry {
+	return httpresponse.NewProblemRegistry()
+}
+
+// DecodeError reports a response body that could not be decoded, along with
+// the response status.
+type DecodeError = httpresponse.DecodeError
+
+// ErrContentLengthMismatch is returned when a multipart body sent with a
+// precomputed Content-Length produces a different number of bytes.
+var ErrContentLengthMismatch = httprequest.ErrContentLengthMismatch
@@ -62,6 +62,7 @@ func main() {
 
 	server1Resp, err := server1Client.GET(context.Background(), "/file").
 		Timeout(30 * time.Second).
+		ExpectStatus(http.StatusOK).
 		Send()
 	if err != nil {
 		logger.Error("Failed to get file from server1", "error", err)
@@ -69,11 +70,6 @@ func main() {
 	}
 	defer server1Resp.Body.Close()
 
-	if server1Resp.StatusCode != http.StatusOK {
-		logger.Error("Server1 returned status", "status", server1Resp.Status)
-		return
-	}
-
 	filename := filename(server1Resp.Header, "default_filename")
 
 	// Wrap response body with counting reader to track streamed data
@@ -82,6 +78,7 @@ func main() {
 	server2Resp, err := server2Client.Multipart(context.Background(), "/upload").
 		File("file", filename, counter).
 		Timeout(30 * time.Second).
+		ExpectStatus(http.StatusOK).
 		Send()
 
 	if err != nil {
@@ -90,11 +87,6 @@ func main() {
 	}
 	defer server2Resp.Body.Close()
 
-	if server2Resp.StatusCode != http.StatusOK {
-		logger.Error("Upload failed with status", "status", server2Resp.Status)
-		return
-	}
-
 	runtime.ReadMemStats(&m)
 	slog.Info("After streaming", "Alloc (KB)", m.Alloc/1024, "TotalAlloc (KB)", m.TotalAlloc/1024)
 
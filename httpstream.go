@@ -6,6 +6,7 @@ import (
 	"net/url"
 
 	"github.com/nativebpm/httpstream/internal/httprequest"
+	"github.com/nativebpm/httpstream/internal/httptransport"
 )
 
 type HttpMethod string
@@ -23,11 +24,21 @@ const (
 )
 
 type Multipart = httprequest.Multipart
+type Parts = httprequest.Parts
 type Request = httprequest.Request
 
 type Client struct {
 	HttpClient http.Client
 	BaseURL    url.URL
+
+	// Problems maps problem+json type URIs of unexpected responses to domain
+	// errors for every request created by the client.
+	Problems *ProblemRegistry
+
+	// Codecs selects the codec Decode uses for each response Content-Type
+	// for every request created by the client. When nil, only JSON is
+	// decoded.
+	Codecs *CodecRegistry
 }
 
 func NewClient(client *http.Client, baseURL string) (*Client, error) {
@@ -50,12 +61,22 @@ func (c *Client) Use(middleware func(http.RoundTripper) http.RoundTripper) *Clie
 	return c
 }
 
+// Request creates a request builder for path. The unexpanded path is kept
+// in the request context as its route template (see ByRoute).
 func (c *Client) Request(ctx context.Context, method HttpMethod, path string) *httprequest.Request {
-	return httprequest.NewRequest(ctx, c.HttpClient, string(method), c.url(path))
+	ctx = httptransport.WithRoute(ctx, path)
+	return httprequest.NewRequest(ctx, c.HttpClient, string(method), c.url(path)).
+		Problems(c.Problems).
+		Codecs(c.Codecs)
 }
 
+// MultipartRequest creates a multipart request builder for path. The
+// unexpanded path is kept in the request context as its route template.
 func (c *Client) MultipartRequest(ctx context.Context, method HttpMethod, path string) *httprequest.Multipart {
-	return httprequest.NewMultipart(ctx, c.HttpClient, string(method), c.url(path))
+	ctx = httptransport.WithRoute(ctx, path)
+	return httprequest.NewMultipart(ctx, c.HttpClient, string(method), c.url(path)).
+		Problems(c.Problems).
+		Codecs(c.Codecs)
 }
 
 func (c *Client) GET(ctx context.Context, path string) *httprequest.Request {
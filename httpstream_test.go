@@ -2,9 +2,14 @@ package httpstream
 
 import (
 	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestNewClient(t *testing.T) {
@@ -109,6 +114,65 @@ func TestClient_NewMultipart(t *testing.T) {
 	// But we can check that it's initialized
 }
 
+func TestClient_MultipartNested(t *testing.T) {
+	var parts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			t.Errorf("invalid Content-Type: %v", err)
+			return
+		}
+		outer := multipart.NewReader(r.Body, params["boundary"])
+		for {
+			part, err := outer.NextPart()
+			if err != nil {
+				break
+			}
+			mediaType, params, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+			if mediaType != "multipart/mixed" {
+				body, _ := io.ReadAll(part)
+				parts = append(parts, part.FormName()+"="+string(body))
+				continue
+			}
+			inner := multipart.NewReader(part, params["boundary"])
+			for {
+				p, err := inner.NextPart()
+				if err != nil {
+					break
+				}
+				body, _ := io.ReadAll(p)
+				parts = append(parts, part.FormName()+"/"+p.FormName()+"="+string(body))
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	hc, _ := NewClient(&http.Client{}, server.URL)
+	resp, err := hc.MultipartRequest(context.Background(), POST, "/upload").
+		Header("X-Test", "nested").
+		Param("title", "batch").
+		Nested("files", nil, func(p *Parts) {
+			p.Param("a", "first").
+				JSON("b", map[string]int{"n": 1})
+		}).
+		Send()
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	resp.Body.Close()
+
+	want := []string{"title=batch", "files/a=first", "files/b={\"n\":1}\n"}
+	if len(parts) != len(want) {
+		t.Fatalf("parts = %q, want %q", parts, want)
+	}
+	for i := range want {
+		if parts[i] != want[i] {
+			t.Errorf("parts[%d] = %q, want %q", i, parts[i], want[i])
+		}
+	}
+}
+
 func TestClient_WithMiddleware(t *testing.T) {
 	// Create a test server
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -148,3 +212,71 @@ func (t *testTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	req.Header.Set("X-Test", "middleware")
 	return t.rt.RoundTrip(req)
 }
+
+type notFoundError struct {
+	Instance string
+}
+
+func (e *notFoundError) Error() string {
+	return "not found: " + e.Instance
+}
+
+func TestClient_Problems(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"type":"urn:problem:not-found","title":"Not Found","status":404,"instance":"/users/42"}`))
+	}))
+	defer server.Close()
+
+	hc, _ := NewClient(&http.Client{}, server.URL)
+	hc.Problems = NewProblemRegistry()
+	hc.Problems.Register("urn:problem:not-found", func(p *Problem) error {
+		return &notFoundError{Instance: p.Instance}
+	})
+
+	_, err := hc.GET(context.Background(), "/users/{id}").PathInt("id", 42).ExpectSuccess().Send()
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected *StatusError, got %v", err)
+	}
+	var notFound *notFoundError
+	if !errors.As(err, &notFound) || notFound.Instance != "/users/42" {
+		t.Errorf("expected *notFoundError, got %v", err)
+	}
+}
+
+func TestDo(t *testing.T) {
+	type User struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/users/1" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":1,"name":"gopher"}`))
+	}))
+	defer server.Close()
+
+	hc, _ := NewClient(&http.Client{}, server.URL)
+	ctx := context.Background()
+
+	user, err := Do[User](hc.GET(ctx, "/users/{id}").PathInt("id", 1).Timeout(time.Second))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if user.ID != 1 || user.Name != "gopher" {
+		t.Errorf("unexpected user: %+v", user)
+	}
+
+	_, err = Do[User](hc.GET(ctx, "/users/{id}").PathInt("id", 2))
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected *StatusError with status 404, got %v", err)
+	}
+}
@@ -0,0 +1,13 @@
+package httpbody
+
+import "io"
+
+// DrainAndClose reads a bounded amount of a discarded response body so the
+// underlying connection can be reused, then closes it.
+func DrainAndClose(body io.ReadCloser) {
+	if body == nil {
+		return
+	}
+	_, _ = io.CopyN(io.Discard, body, 4<<10)
+	_ = body.Close()
+}
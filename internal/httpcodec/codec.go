@@ -0,0 +1,127 @@
+package httpcodec
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"strings"
+	"sync"
+)
+
+// Codec encodes request bodies and decodes response bodies of one media
+// type. Encode and Decode must stream to and from the given writer and
+// reader rather than buffer whole bodies where the format allows it.
+type Codec interface {
+	// ContentType returns the Content-Type of encoded bodies.
+	ContentType() string
+	Encode(w io.Writer, v any) error
+	Decode(r io.Reader, v any) error
+}
+
+// JSON is the Codec for application/json based on encoding/json.
+type JSON struct{}
+
+func (JSON) ContentType() string {
+	return "application/json"
+}
+
+func (JSON) Encode(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (JSON) Decode(r io.Reader, v any) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+// Registry maps media types to codecs. It is safe for concurrent use. A nil
+// *Registry knows only JSON.
+type Registry struct {
+	mu     sync.RWMutex
+	codecs map[string]Codec
+}
+
+// NewRegistry creates a Registry holding codecs, each registered under the
+// media type of its ContentType.
+func NewRegistry(codecs ...Codec) *Registry {
+	r := &Registry{codecs: make(map[string]Codec)}
+	for _, c := range codecs {
+		r.Register(MediaType(c.ContentType()), c)
+	}
+	return r
+}
+
+// Register maps mediaType to c, replacing any previous codec.
+func (r *Registry) Register(mediaType string, c Codec) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.codecs[strings.ToLower(mediaType)] = c
+}
+
+// Lookup returns the codec for a Content-Type. Media types with a
+// structured syntax suffix, such as application/problem+json, fall back to
+// the codec of the suffix, application/json, and then to any codec that
+// accepts the media type as an alias.
+func (r *Registry) Lookup(contentType string) (Codec, bool) {
+	mediaType := MediaType(contentType)
+	if mediaType == "" {
+		return nil, false
+	}
+	candidates := []string{mediaType}
+	if i := strings.LastIndexByte(mediaType, '+'); i >= 0 {
+		candidates = append(candidates, "application/"+mediaType[i+1:])
+	}
+
+	if r == nil {
+		for _, candidate := range candidates {
+			if candidate == "application/json" {
+				return JSON{}, true
+			}
+		}
+		return nil, false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, candidate := range candidates {
+		if c, ok := r.codecs[candidate]; ok {
+			return c, true
+		}
+	}
+	// Aliases such as text/xml for application/xml.
+	for _, c := range r.codecs {
+		if a, ok := c.(interface{ AcceptsMediaType(string) bool }); ok && a.AcceptsMediaType(mediaType) {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// Accepts reports whether c can decode a body of contentType. Codecs that
+// implement AcceptsMediaType(mediaType string) bool decide for themselves;
+// otherwise either the media types match, or contentType has the structured
+// syntax suffix of the codec, as application/problem+json has for
+// application/json.
+func Accepts(c Codec, contentType string) bool {
+	mediaType, own := MediaType(contentType), MediaType(c.ContentType())
+	if mediaType == "" {
+		return false
+	}
+	if a, ok := c.(interface{ AcceptsMediaType(string) bool }); ok {
+		return a.AcceptsMediaType(mediaType)
+	}
+	if mediaType == own {
+		return true
+	}
+	i := strings.LastIndexByte(own, '/')
+	return i >= 0 && strings.HasSuffix(mediaType, "+"+own[i+1:])
+}
+
+// MediaType returns the lowercase media type of a Content-Type value, or ""
+// when it cannot be parsed.
+func MediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
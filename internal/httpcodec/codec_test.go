@@ -0,0 +1,113 @@
+package httpcodec_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"testing"
+
+	"github.com/nativebpm/httpstream/internal/httpcodec"
+)
+
+type textCodec struct{}
+
+func (textCodec) ContentType() string { return "text/plain; charset=utf-8" }
+
+func (textCodec) Encode(w io.Writer, v any) error {
+	_, err := io.WriteString(w, v.(string))
+	return err
+}
+
+func (textCodec) Decode(r io.Reader, v any) error {
+	b, err := io.ReadAll(r)
+	*v.(*string) = string(b)
+	return err
+}
+
+func TestJSON_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := (httpcodec.JSON{}).Encode(&buf, map[string]int{"id": 7}); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	var v struct{ ID int }
+	if err := (httpcodec.JSON{}).Decode(&buf, &v); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if v.ID != 7 {
+		t.Errorf("expected id 7, got %d", v.ID)
+	}
+}
+
+func TestRegistry_Lookup(t *testing.T) {
+	registry := httpcodec.NewRegistry(httpcodec.JSON{}, textCodec{})
+
+	tests := []struct {
+		contentType string
+		want        httpcodec.Codec
+	}{
+		{"application/json", httpcodec.JSON{}},
+		{"application/problem+json; charset=utf-8", httpcodec.JSON{}},
+		{"TEXT/PLAIN", textCodec{}},
+		{"application/xml", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		codec, ok := registry.Lookup(tt.contentType)
+		if ok != (tt.want != nil) || codec != tt.want {
+			t.Errorf("Lookup(%q) = %T, %v; want %T", tt.contentType, codec, ok, tt.want)
+		}
+	}
+}
+
+func TestRegistry_NilKnowsJSON(t *testing.T) {
+	var registry *httpcodec.Registry
+	if _, ok := registry.Lookup("application/vnd.api+json"); !ok {
+		t.Error("expected nil registry to decode JSON")
+	}
+	if _, ok := registry.Lookup("text/plain"); ok {
+		t.Error("expected nil registry to reject text/plain")
+	}
+}
+
+func TestAccepts(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{"application/json", true},
+		{"application/merge-patch+json", true},
+		{"application/jsonl", false},
+		{"text/html", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := httpcodec.Accepts(httpcodec.JSON{}, tt.contentType); got != tt.want {
+			t.Errorf("Accepts(JSON, %q) = %v, want %v", tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestXML_Prolog(t *testing.T) {
+	var buf bytes.Buffer
+	codec := httpcodec.XML{Prolog: xml.Header}
+	if err := codec.Encode(&buf, struct {
+		XMLName xml.Name `xml:"ping"`
+	}{}); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if want := xml.Header + "<ping></ping>"; buf.String() != want {
+		t.Errorf("expected %q, got %q", want, buf.String())
+	}
+}
+
+func TestRegistry_LookupAlias(t *testing.T) {
+	registry := httpcodec.NewRegistry(httpcodec.XML{})
+	for _, contentType := range []string{"application/xml", "text/xml; charset=utf-8", "application/soap+xml"} {
+		if _, ok := registry.Lookup(contentType); !ok {
+			t.Errorf("expected XML codec for %q", contentType)
+		}
+	}
+	if !httpcodec.Accepts(httpcodec.XML{}, "text/xml") {
+		t.Error("expected XML codec to accept text/xml")
+	}
+}
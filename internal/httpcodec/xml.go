@@ -0,0 +1,52 @@
+package httpcodec
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// XML is the Codec for application/xml based on encoding/xml. It also
+// decodes text/xml and media types with the +xml suffix.
+type XML struct {
+	// Prolog is written before each encoded value, typically xml.Header.
+	// Empty writes no prolog.
+	Prolog string
+
+	// Indent, when set, indents nested elements by that string.
+	Indent string
+}
+
+func (XML) ContentType() string {
+	return "application/xml"
+}
+
+func (x XML) Encode(w io.Writer, v any) error {
+	if x.Prolog != "" {
+		if _, err := io.WriteString(w, x.Prolog); err != nil {
+			return err
+		}
+	}
+	enc := xml.NewEncoder(w)
+	if x.Indent != "" {
+		enc.Indent("", x.Indent)
+	}
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func (XML) Decode(r io.Reader, v any) error {
+	return xml.NewDecoder(r).Decode(v)
+}
+
+func (XML) AcceptsMediaType(mediaType string) bool {
+	return IsXML(mediaType)
+}
+
+// IsXML reports whether mediaType is an XML media type: application/xml,
+// text/xml or one with the +xml suffix.
+func IsXML(mediaType string) bool {
+	return mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml")
+}
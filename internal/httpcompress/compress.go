@@ -0,0 +1,74 @@
+package httpcompress
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrUnsupportedEncoding is returned for a content coding that has no
+// built-in or registered implementation.
+var ErrUnsupportedEncoding = errors.New("httpstream: unsupported content encoding")
+
+// Compressor wraps w in a streaming encoder for a content coding. Closing the
+// returned writer flushes the encoder without closing w.
+type Compressor func(w io.Writer) (io.WriteCloser, error)
+
+// NewCompressor returns the Compressor of a built-in content coding: "gzip"
+// or "deflate" (zlib, as HTTP defines it). level is passed to compress/gzip
+// or compress/zlib, for example gzip.BestSpeed; 0 means
+// gzip.DefaultCompression, not gzip.NoCompression.
+func NewCompressor(encoding string, level int) (Compressor, error) {
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	// Validate the level up front rather than on the first request.
+	switch strings.ToLower(encoding) {
+	case "gzip":
+		if _, err := gzip.NewWriterLevel(io.Discard, level); err != nil {
+			return nil, err
+		}
+		return func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriterLevel(w, level)
+		}, nil
+	case "deflate":
+		if _, err := zlib.NewWriterLevel(io.Discard, level); err != nil {
+			return nil, err
+		}
+		return func(w io.Writer) (io.WriteCloser, error) {
+			return zlib.NewWriterLevel(w, level)
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedEncoding, encoding)
+}
+
+// Write runs write with its output compressed into w by c.
+func Write(w io.Writer, c Compressor, write func(w io.Writer) error) error {
+	zw, err := c(w)
+	if err != nil {
+		return err
+	}
+	if err := write(zw); err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+// Reader returns a reader of body compressed by c. Compression runs in a
+// goroutine feeding a pipe; closing the returned reader stops it, and body
+// is closed once it has been consumed or compression stops.
+func Reader(body io.ReadCloser, c Compressor) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		defer body.Close()
+		pw.CloseWithError(Write(pw, c, func(w io.Writer) error {
+			_, err := io.Copy(w, body)
+			return err
+		}))
+	}()
+	return pr
+}
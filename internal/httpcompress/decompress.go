@@ -0,0 +1,43 @@
+package httpcompress
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+)
+
+// Decompressor wraps r in a streaming decoder for a content coding. Closing
+// the returned reader releases the decoder without closing r.
+type Decompressor func(r io.Reader) (io.ReadCloser, error)
+
+// NewDecompressor returns the Decompressor of a built-in content coding:
+// "gzip" (or "x-gzip") or "deflate".
+func NewDecompressor(encoding string) (Decompressor, bool) {
+	switch strings.ToLower(encoding) {
+	case "gzip", "x-gzip":
+		return func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		}, true
+	case "deflate":
+		return newDeflateReader, true
+	}
+	return nil, false
+}
+
+// newDeflateReader decodes "deflate" bodies. HTTP defines them as zlib
+// streams, but some servers send raw DEFLATE data, so the zlib header is
+// checked before choosing the decoder.
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil && len(header) == 0 {
+		return nil, err
+	}
+	if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
@@ -0,0 +1,50 @@
+package httprequest
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/nativebpm/httpstream/internal/httpcompress"
+)
+
+// compression is the content coding applied to a request body.
+type compression struct {
+	encoding   string
+	compressor httpcompress.Compressor
+	err        error
+}
+
+func (c *compression) enabled() bool {
+	return c.compressor != nil
+}
+
+// wrap returns write with its output compressed, or write itself when
+// compression is off.
+func (c *compression) wrap(write func(w io.Writer) error) func(w io.Writer) error {
+	if !c.enabled() {
+		return write
+	}
+	return func(w io.Writer) error {
+		return httpcompress.Write(w, c.compressor, write)
+	}
+}
+
+// apply sets Content-Encoding on a request with a body and drops its
+// Content-Length, which no longer matches the compressed body.
+func (c *compression) apply(req *http.Request) {
+	if !c.enabled() || req.Body == nil || req.Body == http.NoBody {
+		return
+	}
+	req.Header.Set("Content-Encoding", c.encoding)
+	req.Header.Del("Content-Length")
+	req.ContentLength = 0
+}
+
+// copyBody returns a producer that copies body and closes it.
+func copyBody(body io.ReadCloser) func(w io.Writer) error {
+	return func(w io.Writer) error {
+		defer body.Close()
+		_, err := io.Copy(w, body)
+		return err
+	}
+}
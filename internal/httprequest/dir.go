@@ -0,0 +1,100 @@
+package httprequest
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"path"
+	"strings"
+)
+
+// dirSource is a directory tree uploaded by Multipart.Dir or Parts.Dir.
+type dirSource struct {
+	fsys   fs.FS
+	root   string
+	filter func(path string, d fs.DirEntry) bool
+}
+
+// walk calls fn with the path in fsys and the path relative to the root of
+// every regular file that passes the filter, in lexical order.
+func (s *dirSource) walk(fn func(p, name string, d fs.DirEntry) error) error {
+	return fs.WalkDir(s.fsys, s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := p
+		switch {
+		case p == s.root && d.IsDir():
+			return nil
+		case p == s.root:
+			// The root is a single file.
+			name = path.Base(p)
+		case s.root != ".":
+			name = strings.TrimPrefix(p, s.root+"/")
+		}
+		if s.filter != nil && !s.filter(name, d) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return fn(p, name, d)
+	})
+}
+
+// write writes one part per file, opening each file only while its part is
+// being written.
+func (s *dirSource) write(ctx context.Context, mw *multipart.Writer, key string) error {
+	return s.walk(func(p, name string, _ fs.DirEntry) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		file, err := s.fsys.Open(p)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		part, err := mw.CreatePart(dirPartHeader(key, name))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(part, file)
+		return err
+	})
+}
+
+// length adds the parts of the tree to a dry run of the body, using the
+// file sizes reported by the directory entries.
+func (s *dirSource) length(mw *multipart.Writer, cw *countingWriter, key string) error {
+	return s.walk(func(_, name string, d fs.DirEntry) error {
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if _, err := mw.CreatePart(dirPartHeader(key, name)); err != nil {
+			return err
+		}
+		cw.n += info.Size()
+		return nil
+	})
+}
+
+// dirPartHeader returns the header of the part of a file: its relative path
+// as the filename and a Content-Type guessed from its extension.
+func dirPartHeader(key, name string) textproto.MIMEHeader {
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = string(applicationOctetStream)
+	}
+	header := make(textproto.MIMEHeader, 2)
+	header.Set("Content-Disposition", formDataDisposition(key, name))
+	header.Set("Content-Type", contentType)
+	return header
+}
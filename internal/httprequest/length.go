@@ -0,0 +1,142 @@
+package httprequest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"strings"
+)
+
+// ErrContentLengthMismatch is returned when a multipart body sent with a
+// precomputed Content-Length produces a different number of bytes, for
+// example because a file changed after the request was built.
+var ErrContentLengthMismatch = errors.New("httpstream: multipart body does not match its Content-Length")
+
+// lengthMode selects whether Send precomputes the Content-Length of a
+// multipart body.
+type lengthMode int
+
+const (
+	// lengthAuto sizes bodies whose fields have a known size, except Dir
+	// fields.
+	lengthAuto lengthMode = iota
+	// lengthChunked never sizes bodies.
+	lengthChunked
+	// lengthWalk also sizes Dir fields by walking their trees.
+	lengthWalk
+)
+
+// contentLength returns the exact length of the multipart body of p for
+// boundary, or false when the size of a field is not known up front. Dir
+// fields are only sized when walk is set.
+func (p *Parts) contentLength(boundary string, walk bool) (int64, bool) {
+	var cw countingWriter
+	mw := multipart.NewWriter(&cw)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return 0, false
+	}
+	for _, field := range p.fields {
+		if field.dir != nil {
+			if !walk {
+				return 0, false
+			}
+			if err := field.dir.length(mw, &cw, field.key); err != nil {
+				return 0, false
+			}
+			continue
+		}
+		size, ok := fieldLength(field, walk)
+		if !ok {
+			return 0, false
+		}
+		if _, err := mw.CreatePart(partHeader(field)); err != nil {
+			return 0, false
+		}
+		cw.n += size
+	}
+	if err := mw.Close(); err != nil {
+		return 0, false
+	}
+	return cw.n, true
+}
+
+// fieldLength returns the number of content bytes of field, or false when
+// it is not known without producing the content. walk is passed on to
+// nested bodies.
+func fieldLength(field multipartField, walk bool) (int64, bool) {
+	switch {
+	case field.nested != nil:
+		return field.nested.contentLength(field.boundary, walk)
+	case field.write != nil:
+		return 0, false
+	case field.header != nil && field.header.Get("Content-Type") == "" && field.file != nil:
+		// The Content-Type header depends on sniffed content.
+		return 0, false
+	case field.contentType == multipartFormData:
+		return int64(len(field.value)), true
+	case field.sized:
+		return field.size, true
+	case field.file == nil:
+		return 0, true
+	}
+	return readerSize(field.file)
+}
+
+// readerSize returns the number of bytes left in r when it can tell
+// without reading.
+func readerSize(r io.Reader) (int64, bool) {
+	switch r := r.(type) {
+	case *bytes.Reader:
+		return int64(r.Len()), true
+	case *strings.Reader:
+		return int64(r.Len()), true
+	case *os.File:
+		info, err := r.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return 0, false
+		}
+		offset, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, false
+		}
+		return info.Size() - offset, true
+	}
+	return 0, false
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// exactWriter fails writes that go past the precomputed length, so no
+// extra bytes reach the connection.
+type exactWriter struct {
+	w      io.Writer
+	length int64
+	n      int64
+}
+
+func (e *exactWriter) Write(p []byte) (int, error) {
+	if e.n+int64(len(p)) > e.length {
+		return 0, fmt.Errorf("%w: more than %d bytes", ErrContentLengthMismatch, e.length)
+	}
+	n, err := e.w.Write(p)
+	e.n += int64(n)
+	return n, err
+}
+
+// close reports a body that ended short of the precomputed length.
+func (e *exactWriter) close() error {
+	if e.n != e.length {
+		return fmt.Errorf("%w: %d of %d bytes", ErrContentLengthMismatch, e.n, e.length)
+	}
+	return nil
+}
@@ -1,13 +1,21 @@
 package httprequest
 
 import (
+	"bufio"
 	"context"
 	"io"
+	"io/fs"
+	"mime"
 	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/nativebpm/httpstream/internal/httpcodec"
+	"github.com/nativebpm/httpstream/internal/httpcompress"
+	"github.com/nativebpm/httpstream/internal/httpresponse"
 )
 
 // multipartField represents a field in a multipart form
@@ -15,14 +23,30 @@ type multipartField struct {
 	contentType contentType
 	key, value  string
 	file        io.Reader
+	write       func(w io.Writer) error
+	header      textproto.MIMEHeader
+	nested      *Parts
+	boundary    string
+	size        int64
+	sized       bool
+	dir         *dirSource
 }
 
-// Multipart provides a streaming multipart/form-data builder for HTTP requests.
+// Multipart provides a streaming multipart builder for HTTP requests. Bodies
+// are multipart/form-data unless Related or Mixed is called.
 type Multipart struct {
-	client     http.Client
-	request    *http.Request
-	fields     []multipartField
-	cancelFunc context.CancelFunc
+	client      http.Client
+	request     *http.Request
+	parts       Parts
+	cancelFunc  context.CancelFunc
+	spoolCfg    *spoolConfig
+	spool       *spool
+	pipe        *io.PipeReader
+	expect      func(code int) bool
+	problems    *httpresponse.ProblemRegistry
+	codecs      *httpcodec.Registry
+	compression compression
+	length      lengthMode
 }
 
 // NewMultipart creates a new streaming multipart/form-data request builder.
@@ -31,7 +55,7 @@ func NewMultipart(ctx context.Context, client http.Client, method, url string) *
 	return &Multipart{
 		client:  client,
 		request: request,
-		fields:  make([]multipartField, 0, 16),
+		parts:   Parts{fields: make([]multipartField, 0, 16)},
 	}
 }
 
@@ -53,63 +77,293 @@ func (r *Multipart) Timeout(duration time.Duration) *Multipart {
 
 // Send executes the HTTP request and returns the response.
 func (r *Multipart) Send() (*http.Response, error) {
+	if err := r.compression.err; err != nil {
+		if release := r.release(); release != nil {
+			release()
+		}
+		return nil, err
+	}
+
 	ctx := r.request.Context()
 
-	pr, pw := io.Pipe()
-	mw := multipart.NewWriter(pw)
-	r.request.Body = pr
+	// The boundary is needed for the header before the producer starts.
+	boundary := newBoundary()
+	r.request.Header.Set("Content-Type", r.parts.mediaType(boundary))
 
-	r.request.Header.Set("Content-Type", mw.FormDataContentType())
+	write := func(w io.Writer) error {
+		return r.parts.writeParts(ctx, w, boundary)
+	}
+	if length, ok := r.parts.contentLength(boundary, r.length == lengthWalk); ok && r.length != lengthChunked && !r.compression.enabled() {
+		// Send a Content-Length instead of a chunked body.
+		r.request.ContentLength = length
+		write = func(w io.Writer) error {
+			ew := &exactWriter{w: w, length: length}
+			if err := r.parts.writeParts(ctx, ew, boundary); err != nil {
+				return err
+			}
+			return ew.close()
+		}
+	}
 
-	go func() {
-		defer pw.Close()
-		defer mw.Close()
+	r.pipe = pipeBody(ctx, r.compression.wrap(write))
+	r.request.Body = r.pipe
+	r.compression.apply(r.request)
 
-		for _, field := range r.fields {
-			select {
-			case <-ctx.Done():
-				pw.CloseWithError(ctx.Err())
-				return
-			default:
-			}
-			switch field.contentType {
-			case multipartFormData:
-				if err := mw.WriteField(field.key, field.value); err != nil {
-					pw.CloseWithError(err)
-					return
-				}
-			case applicationOctetStream:
-				part, err := mw.CreateFormFile(field.key, field.value)
-				if err != nil {
-					pw.CloseWithError(err)
-					return
-				}
-				if _, err := io.Copy(part, field.file); err != nil {
-					pw.CloseWithError(err)
-					return
-				}
+	return r.sendRequest()
+}
+
+// newBoundary returns a random multipart boundary.
+func newBoundary() string {
+	return multipart.NewWriter(nil).Boundary()
+}
+
+// mediaType returns the Content-Type of the body for boundary.
+func (p *Parts) mediaType(boundary string) string {
+	subtype := p.subtype
+	if subtype == "" {
+		subtype = "form-data"
+	}
+	params := map[string]string{"boundary": boundary}
+	for k, v := range p.params {
+		params[k] = v
+	}
+	return mime.FormatMediaType("multipart/"+subtype, params)
+}
+
+// writeParts writes the fields of p to w as a multipart body.
+func (p *Parts) writeParts(ctx context.Context, w io.Writer, boundary string) error {
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return err
+	}
+	for _, field := range p.fields {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if field.dir != nil {
+			if err := field.dir.write(ctx, mw, field.key); err != nil {
+				return err
 			}
+			continue
+		}
+		if err := writeField(ctx, mw, field); err != nil {
+			return err
 		}
-	}()
+	}
+	return mw.Close()
+}
 
-	return r.sendRequest()
+// writeField writes one field as a part of mw. Fields added with Part and
+// no Content-Type header have their content type sniffed from the first
+// 512 bytes of the content, which are the only bytes buffered.
+func writeField(ctx context.Context, mw *multipart.Writer, field multipartField) error {
+	header := partHeader(field)
+	content := field.file
+	if field.header != nil && header.Get("Content-Type") == "" && content != nil {
+		br := bufio.NewReaderSize(content, sniffLen)
+		head, err := br.Peek(sniffLen)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		header.Set("Content-Type", http.DetectContentType(head))
+		content = br
+	}
+
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	switch {
+	case field.nested != nil:
+		return field.nested.writeParts(ctx, part, field.boundary)
+	case field.write != nil:
+		return field.write(part)
+	case field.contentType == multipartFormData:
+		_, err = io.WriteString(part, field.value)
+	case content != nil:
+		_, err = io.Copy(part, content)
+	}
+	return err
+}
+
+// partHeader returns the MIME header of the part of field, before any
+// content sniffing.
+func partHeader(field multipartField) textproto.MIMEHeader {
+	header := make(textproto.MIMEHeader, len(field.header)+2)
+	for k, v := range field.header {
+		header[k] = v
+	}
+
+	switch {
+	case field.header != nil:
+		if field.key != "" && header.Get("Content-Disposition") == "" {
+			header.Set("Content-Disposition", formDataDisposition(field.key, field.value))
+		}
+		if field.nested != nil {
+			header.Set("Content-Type", field.nested.mediaType(field.boundary))
+		}
+	case field.contentType == multipartFormData:
+		header.Set("Content-Disposition", formDataDisposition(field.key, ""))
+	case field.contentType == applicationOctetStream:
+		header.Set("Content-Disposition", formDataDisposition(field.key, field.value))
+		header.Set("Content-Type", string(applicationOctetStream))
+	}
+	return header
+}
+
+// sniffLen is the number of bytes http.DetectContentType considers.
+const sniffLen = 512
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// formDataDisposition returns the Content-Disposition of a form-data part,
+// quoted the way mime/multipart quotes it.
+func formDataDisposition(key, filename string) string {
+	disposition := `form-data; name="` + quoteEscaper.Replace(key) + `"`
+	if filename != "" {
+		disposition += `; filename="` + quoteEscaper.Replace(filename) + `"`
+	}
+	return disposition
+}
+
+// Decode sends the request and stream-decodes the response body into v
+// with the codec registered for its Content-Type (JSON when no registry was
+// set), closing the body. Unless ExpectStatus was set, responses that are
+// not 2xx fail with a *StatusError; bodies that cannot be decoded fail with
+// a *DecodeError.
+func (r *Multipart) Decode(v any) error {
+	resp, err := r.sendExpectingSuccess()
+	if err != nil {
+		return err
+	}
+	return httpresponse.Decode(resp, r.codecs, v)
+}
+
+// DecodeWith is like Decode but always decodes the response body with
+// codec, failing with a *DecodeError when the codec does not accept the
+// response Content-Type.
+func (r *Multipart) DecodeWith(codec httpcodec.Codec, v any) error {
+	resp, err := r.sendExpectingSuccess()
+	if err != nil {
+		return err
+	}
+	return httpresponse.DecodeWith(resp, codec, v)
+}
+
+func (r *Multipart) sendExpectingSuccess() (*http.Response, error) {
+	if r.expect == nil {
+		r.expect = httpresponse.IsSuccess
+	}
+	return r.Send()
 }
 
 func (r *Multipart) sendRequest() (*http.Response, error) {
+	r.spool = spoolRequest(r.request, r.spoolCfg)
 	resp, err := r.client.Do(r.request)
+	release := r.release()
 	if err != nil {
-		if r.cancelFunc != nil {
-			r.cancelFunc()
+		if release != nil {
+			release()
 		}
 		return nil, err
 	}
-	if r.cancelFunc != nil {
-		resp.Body = &cancelCloser{resp.Body, r.cancelFunc}
-		r.cancelFunc = nil
+	if release != nil {
+		resp.Body = &cancelCloser{resp.Body, release}
+	}
+	if r.expect != nil && !r.expect(resp.StatusCode) {
+		return nil, httpresponse.NewStatusError(resp, r.problems)
 	}
 	return resp, nil
 }
 
+// release returns a function that cancels the request timeout, stops the
+// body producer and removes the spooled body, or nil when there is nothing
+// to release.
+func (r *Multipart) release() context.CancelFunc {
+	cancel, pipe, s := r.cancelFunc, r.pipe, r.spool
+	r.cancelFunc, r.pipe, r.spool = nil, nil, nil
+	return releaseFunc(cancel, pipe, s)
+}
+
+// Spool makes the request body rewindable. The body is teed into a buffer
+// that stays in memory up to maxMemory bytes and overflows to a temporary
+// file in dir (os.TempDir when empty), and GetBody is populated so redirects
+// and retries can re-send the same bytes without re-running the producer.
+// Spooled data is removed when the response body is closed.
+func (r *Multipart) Spool(maxMemory int64, dir string) *Multipart {
+	r.spoolCfg = &spoolConfig{maxMemory: maxMemory, dir: dir}
+	return r
+}
+
+// Chunked sends the body chunked even when Send could set its
+// Content-Length, as it does when every field is a string, an *os.File,
+// *bytes.Reader or *strings.Reader, or a SizedFile.
+func (r *Multipart) Chunked() *Multipart {
+	r.length = lengthChunked
+	return r
+}
+
+// ContentLength makes Send compute the Content-Length of a body with Dir
+// fields, which are otherwise sent chunked: their trees are walked and the
+// sizes of their files read before the first byte is sent, and Send fails
+// with ErrContentLengthMismatch if the files change in the meantime.
+func (r *Multipart) ContentLength() *Multipart {
+	r.length = lengthWalk
+	return r
+}
+
+// Compress streams the multipart body through a compressor for encoding,
+// "gzip" or "deflate", at level (see compress/gzip; 0 is the default),
+// sets Content-Encoding and drops Content-Length. Send fails with
+// ErrUnsupportedEncoding for other encodings; use CompressWith for those.
+func (r *Multipart) Compress(encoding string, level int) *Multipart {
+	compressor, err := httpcompress.NewCompressor(encoding, level)
+	r.compression = compression{encoding: encoding, compressor: compressor, err: err}
+	return r
+}
+
+// CompressWith is like Compress for a content coding implemented by
+// compressor, such as zstd from a third-party package.
+func (r *Multipart) CompressWith(encoding string, compressor func(w io.Writer) (io.WriteCloser, error)) *Multipart {
+	r.compression = compression{encoding: encoding, compressor: compressor}
+	return r
+}
+
+// ExpectStatus makes Send fail with a *StatusError, after closing the
+// response body, when the response status is not one of codes.
+func (r *Multipart) ExpectStatus(codes ...int) *Multipart {
+	r.expect = func(code int) bool {
+		for _, c := range codes {
+			if c == code {
+				return true
+			}
+		}
+		return false
+	}
+	return r
+}
+
+// ExpectSuccess makes Send fail with a *StatusError, after closing the
+// response body, when the response status is not 2xx.
+func (r *Multipart) ExpectSuccess() *Multipart {
+	r.expect = httpresponse.IsSuccess
+	return r
+}
+
+// Problems sets the registry used to map problem+json documents of
+// unexpected responses to domain errors.
+func (r *Multipart) Problems(registry *httpresponse.ProblemRegistry) *Multipart {
+	r.problems = registry
+	return r
+}
+
+// Codecs sets the registry Decode uses to pick a codec by response
+// Content-Type.
+func (r *Multipart) Codecs(registry *httpcodec.Registry) *Multipart {
+	r.codecs = registry
+	return r
+}
+
 // Header sets an HTTP header on the request.
 func (r *Multipart) Header(key, value string) *Multipart {
 	r.request.Header.Set(key, value)
@@ -142,7 +396,7 @@ func (r *Multipart) PathFloat(key string, value float64) *Multipart {
 
 // Param adds a string field to the multipart form.
 func (r *Multipart) Param(key, value string) *Multipart {
-	r.fields = append(r.fields, multipartField{contentType: multipartFormData, key: key, value: value})
+	r.parts.Param(key, value)
 	return r
 }
 
@@ -163,7 +417,77 @@ func (r *Multipart) Int(key string, value int) *Multipart {
 
 // File adds a file field to the multipart form.
 func (r *Multipart) File(key, filename string, content io.Reader) *Multipart {
-	r.fields = append(r.fields, multipartField{contentType: applicationOctetStream, key: key, value: filename, file: content})
+	r.parts.File(key, filename, content)
+	return r
+}
+
+// Part adds a part with arbitrary MIME headers, which may be nil. It gets a
+// form-data Content-Disposition unless header sets one, and a Content-Type
+// sniffed from the first 512 bytes of content unless header sets one.
+func (r *Multipart) Part(key, filename string, header textproto.MIMEHeader, content io.Reader) *Multipart {
+	r.parts.Part(key, filename, header, content)
+	return r
+}
+
+// Related makes the body multipart/related (RFC 2387) with a root part of
+// type rootType and, when not empty, Content-ID start.
+func (r *Multipart) Related(rootType, start string) *Multipart {
+	r.parts.Related(rootType, start)
+	return r
+}
+
+// Mixed makes the body multipart/mixed, as used by batch APIs. Parts are
+// added with Part and an empty key, so they get no form-data
+// Content-Disposition.
+func (r *Multipart) Mixed() *Multipart {
+	r.parts.Mixed()
+	return r
+}
+
+// Nested adds a part that is itself a multipart body, multipart/mixed
+// unless build calls Related, with the parts added by build. build runs
+// immediately. header may be nil; its Content-Type is replaced.
+func (r *Multipart) Nested(key string, header textproto.MIMEHeader, build func(p *Parts)) *Multipart {
+	r.parts.Nested(key, header, build)
+	return r
+}
+
+// JSON adds a field whose content is v encoded as JSON, streamed into the
+// part with Content-Type application/json.
+func (r *Multipart) JSON(key string, v any) *Multipart {
+	return r.Encode(key, httpcodec.JSON{}, v)
+}
+
+// Encode adds a field whose content is v encoded with codec, streamed into
+// the part with the codec's Content-Type. An encoding error aborts the
+// request.
+func (r *Multipart) Encode(key string, codec httpcodec.Codec, v any) *Multipart {
+	r.parts.Encode(key, codec, v)
+	return r
+}
+
+// SizedFile adds a file field like File whose content is size bytes long,
+// so Send can set Content-Length; any other length fails the request with
+// ErrContentLengthMismatch.
+func (r *Multipart) SizedFile(key, filename string, content io.Reader, size int64) *Multipart {
+	r.parts.SizedFile(key, filename, content, size)
+	return r
+}
+
+// Dir adds a file field named key per regular file under root in fsys,
+// opening one at a time while the body is written and sending it chunked
+// unless ContentLength is called. filter, when not nil, skips the files
+// and directories for which it returns false.
+func (r *Multipart) Dir(key string, fsys fs.FS, root string, filter func(path string, d fs.DirEntry) bool) *Multipart {
+	r.parts.Dir(key, fsys, root, filter)
+	return r
+}
+
+// FileWriter adds a file field whose content is the output of fn, which runs
+// in the producer goroutine while the part is being written. An error
+// returned by fn aborts the request.
+func (r *Multipart) FileWriter(key, filename string, fn func(w io.Writer) error) *Multipart {
+	r.parts.FileWriter(key, filename, fn)
 	return r
 }
 
@@ -2,16 +2,26 @@ package httprequest_test
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
+	"errors"
 	"io"
+	"io/fs"
 	"mime"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
 	"time"
 
+	"github.com/nativebpm/httpstream/internal/httpcodec"
 	"github.com/nativebpm/httpstream/internal/httprequest"
 )
 
@@ -970,3 +980,546 @@ func TestMultipart_ComplexPathChaining(t *testing.T) {
 		t.Errorf("expected status 200, got %d", resp.StatusCode)
 	}
 }
+
+func TestMultipart_FileWriter(t *testing.T) {
+	var receivedFilename, receivedContent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, header, err := r.FormFile("report")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		data, _ := io.ReadAll(file)
+		receivedFilename, receivedContent = header.Filename, string(data)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := http.Client{}
+	ctx := context.Background()
+
+	resp, err := httprequest.NewMultipart(ctx, client, http.MethodPost, server.URL).
+		FileWriter("report", "report.txt", func(w io.Writer) error {
+			_, err := io.WriteString(w, "generated content")
+			return err
+		}).
+		Send()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200, got %d", resp.StatusCode)
+	}
+	if receivedFilename != "report.txt" || receivedContent != "generated content" {
+		t.Errorf("unexpected file %q with content %q", receivedFilename, receivedContent)
+	}
+}
+
+func TestMultipart_Compress(t *testing.T) {
+	var files []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("expected Content-Encoding gzip, got %q", r.Header.Get("Content-Encoding"))
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("gzip.NewReader: %v", err)
+			return
+		}
+		_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		mr := multipart.NewReader(zr, params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Errorf("failed to read part: %v", err)
+				return
+			}
+			data, _ := io.ReadAll(p)
+			files = append(files, p.FileName()+":"+strconv.Itoa(len(data)))
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	resp, err := httprequest.NewMultipart(context.Background(), http.Client{}, http.MethodPost, server.URL).
+		File("file", "big.txt", strings.NewReader(strings.Repeat("x", 1<<20))).
+		Compress("gzip", gzip.BestSpeed).
+		Send()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if len(files) != 1 || files[0] != "big.txt:1048576" {
+		t.Errorf("unexpected parts %v", files)
+	}
+}
+
+type receivedPart struct {
+	header   textproto.MIMEHeader
+	name     string
+	filename string
+	body     string
+}
+
+// readParts reads every part of a multipart request body.
+func readParts(t *testing.T, r *http.Request) []receivedPart {
+	t.Helper()
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		t.Errorf("failed to parse media type: %v", err)
+		return nil
+	}
+	var parts []receivedPart
+	mr := multipart.NewReader(r.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			return parts
+		}
+		if err != nil {
+			t.Errorf("failed to read part: %v", err)
+			return parts
+		}
+		data, _ := io.ReadAll(p)
+		parts = append(parts, receivedPart{header: p.Header, name: p.FormName(), filename: p.FileName(), body: string(data)})
+	}
+}
+
+func TestMultipart_Part(t *testing.T) {
+	var parts []receivedPart
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts = readParts(t, r)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	png := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 2048)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", "text/csv; charset=utf-8")
+	header.Set("Content-ID", "<report@example.com>")
+	header.Set("Content-Transfer-Encoding", "8bit")
+
+	resp, err := httprequest.NewMultipart(context.Background(), http.Client{}, http.MethodPost, server.URL).
+		Part("report", "report.csv", header, strings.NewReader("a,b\n1,2\n")).
+		Part("image", "logo.png", nil, strings.NewReader(png)).
+		Part("note", "", nil, strings.NewReader("plain text")).
+		Send()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if len(parts) != 3 {
+		t.Fatalf("expected 3 parts, got %d", len(parts))
+	}
+
+	report := parts[0]
+	if report.name != "report" || report.filename != "report.csv" || report.body != "a,b\n1,2\n" {
+		t.Errorf("unexpected report part %+v", report)
+	}
+	if report.header.Get("Content-Type") != "text/csv; charset=utf-8" ||
+		report.header.Get("Content-ID") != "<report@example.com>" ||
+		report.header.Get("Content-Transfer-Encoding") != "8bit" {
+		t.Errorf("expected custom headers, got %v", report.header)
+	}
+
+	if ct := parts[1].header.Get("Content-Type"); ct != "image/png" || parts[1].body != png {
+		t.Errorf("expected sniffed image/png with the full content, got %q and %d bytes", ct, len(parts[1].body))
+	}
+	if ct := parts[2].header.Get("Content-Type"); ct != "text/plain; charset=utf-8" || parts[2].filename != "" {
+		t.Errorf("expected sniffed text field without filename, got %q, %q", ct, parts[2].filename)
+	}
+}
+
+func TestMultipart_JSONAndEncodedParts(t *testing.T) {
+	var parts []receivedPart
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts = readParts(t, r)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	type metadata struct {
+		Title string   `json:"title" xml:"title"`
+		Tags  []string `json:"tags" xml:"tag"`
+	}
+	meta := metadata{Title: "Quarterly report", Tags: []string{"finance", "q3"}}
+
+	resp, err := httprequest.NewMultipart(context.Background(), http.Client{}, http.MethodPost, server.URL).
+		JSON("metadata", meta).
+		Encode("legacy", httpcodec.XML{}, meta).
+		File("file", "report.pdf", strings.NewReader("%PDF-1.7")).
+		Send()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if len(parts) != 3 {
+		t.Fatalf("expected 3 parts, got %d", len(parts))
+	}
+	if parts[0].name != "metadata" || parts[0].header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected JSON part %+v", parts[0])
+	}
+	if want := `{"title":"Quarterly report","tags":["finance","q3"]}` + "\n"; parts[0].body != want {
+		t.Errorf("expected body %q, got %q", want, parts[0].body)
+	}
+	if parts[1].header.Get("Content-Type") != "application/xml" ||
+		parts[1].body != `<metadata><title>Quarterly report</title><tag>finance</tag><tag>q3</tag></metadata>` {
+		t.Errorf("unexpected XML part %+v", parts[1])
+	}
+}
+
+func TestMultipart_EncodeErrorAbortsRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	_, err := httprequest.NewMultipart(context.Background(), http.Client{}, http.MethodPost, server.URL).
+		JSON("metadata", map[string]any{"bad": make(chan int)}).
+		Send()
+	var unsupported *json.UnsupportedTypeError
+	if !errors.As(err, &unsupported) {
+		t.Errorf("expected *json.UnsupportedTypeError, got %v", err)
+	}
+}
+
+func TestMultipart_Related(t *testing.T) {
+	var mediaType string
+	var params map[string]string
+	var parts []receivedPart
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mediaType, params, _ = mime.ParseMediaType(r.Header.Get("Content-Type"))
+		parts = readParts(t, r)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	media := textproto.MIMEHeader{}
+	media.Set("Content-Type", "video/mp4")
+	media.Set("Content-ID", "<media>")
+
+	resp, err := httprequest.NewMultipart(context.Background(), http.Client{}, http.MethodPost, server.URL).
+		Related("application/json", "<meta>").
+		Part("", "", textproto.MIMEHeader{"Content-Type": {"application/json"}, "Content-Id": {"<meta>"}}, strings.NewReader(`{"title":"clip"}`)).
+		Part("", "", media, strings.NewReader("....ftypmp42")).
+		Send()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if mediaType != "multipart/related" || params["type"] != "application/json" || params["start"] != "<meta>" || params["boundary"] == "" {
+		t.Errorf("unexpected Content-Type %s %v", mediaType, params)
+	}
+	if len(parts) != 2 {
+		t.Fatalf("expected 2 parts, got %d", len(parts))
+	}
+	for _, part := range parts {
+		if part.header.Get("Content-Disposition") != "" {
+			t.Errorf("expected no Content-Disposition, got %q", part.header.Get("Content-Disposition"))
+		}
+	}
+	if parts[0].header.Get("Content-ID") != "<meta>" || parts[1].body != "....ftypmp42" {
+		t.Errorf("unexpected parts %+v", parts)
+	}
+}
+
+func TestMultipart_NestedMixed(t *testing.T) {
+	var outer []receivedPart
+	var inner []receivedPart
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		outer = readParts(t, r)
+		if len(outer) == 2 {
+			nested := &http.Request{Header: http.Header{"Content-Type": {outer[1].header.Get("Content-Type")}}, Body: io.NopCloser(strings.NewReader(outer[1].body))}
+			inner = readParts(t, nested)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	resp, err := httprequest.NewMultipart(context.Background(), http.Client{}, http.MethodPost, server.URL).
+		Param("title", "batch").
+		Nested("files", nil, func(p *httprequest.Parts) {
+			p.Part("", "a.txt", textproto.MIMEHeader{"Content-Disposition": {`file; filename="a.txt"`}}, strings.NewReader("first")).
+				Part("", "b.txt", textproto.MIMEHeader{"Content-Disposition": {`file; filename="b.txt"`}}, strings.NewReader("second")).
+				FileWriter("gen", "gen.txt", func(w io.Writer) error {
+					_, err := io.WriteString(w, "generated")
+					return err
+				})
+		}).
+		Send()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if len(outer) != 2 || outer[0].body != "batch" || outer[1].name != "files" {
+		t.Fatalf("unexpected outer parts %+v", outer)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(outer[1].header.Get("Content-Type")); mediaType != "multipart/mixed" {
+		t.Errorf("expected nested multipart/mixed, got %s", mediaType)
+	}
+	if len(inner) != 3 || inner[0].filename != "a.txt" || inner[1].body != "second" || inner[2].body != "generated" {
+		t.Errorf("unexpected nested parts %+v", inner)
+	}
+}
+
+func TestMultipart_ContentLength(t *testing.T) {
+	type received struct {
+		contentLength    int64
+		transferEncoding []string
+		bodyLength       int
+	}
+	var got received
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = received{r.ContentLength, r.TransferEncoding, len(body)}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	file, err := os.CreateTemp(t.TempDir(), "upload-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(strings.Repeat("f", 10_000)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Seek(100, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		build func(*httprequest.Multipart) *httprequest.Multipart
+		known bool
+	}{
+		{
+			name: "known sizes",
+			build: func(m *httprequest.Multipart) *httprequest.Multipart {
+				return m.Param("title", "report").
+					File("os", "os.bin", file).
+					File("bytes", "b.bin", bytes.NewReader([]byte("bytes"))).
+					SizedFile("hinted", "h.bin", io.LimitReader(strings.NewReader(strings.Repeat("h", 64)), 64), 64).
+					Part("", "", textproto.MIMEHeader{"Content-Type": {"text/plain"}}, strings.NewReader("part")).
+					Nested("nested", nil, func(n *httprequest.Parts) {
+						n.Part("", "", textproto.MIMEHeader{"Content-Type": {"text/plain"}}, strings.NewReader("inner")).
+							SizedFile("hinted", "h.bin", io.LimitReader(strings.NewReader("hint"), 4), 4)
+					})
+			},
+			known: true,
+		},
+		{
+			name: "streamed writer",
+			build: func(m *httprequest.Multipart) *httprequest.Multipart {
+				return m.Param("title", "report").FileWriter("gen", "gen.txt", func(w io.Writer) error {
+					_, err := io.WriteString(w, "generated")
+					return err
+				})
+			},
+		},
+		{
+			name: "unsized reader",
+			build: func(m *httprequest.Multipart) *httprequest.Multipart {
+				return m.File("pipe", "p.bin", io.LimitReader(strings.NewReader("abc"), 3))
+			},
+		},
+		{
+			name: "buffer",
+			build: func(m *httprequest.Multipart) *httprequest.Multipart {
+				return m.File("buf", "b.bin", bytes.NewBufferString("abc"))
+			},
+		},
+		{
+			name: "chunked",
+			build: func(m *httprequest.Multipart) *httprequest.Multipart {
+				return m.Param("title", "report").
+					File("bytes", "b.bin", bytes.NewReader([]byte("bytes"))).
+					Chunked()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.build(httprequest.NewMultipart(context.Background(), http.Client{}, http.MethodPost, server.URL)).Send()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp.Body.Close()
+
+			if tt.known {
+				if got.contentLength != int64(got.bodyLength) || len(got.transferEncoding) != 0 {
+					t.Errorf("expected Content-Length %d without chunking, got %+v", got.bodyLength, got)
+				}
+			} else if got.contentLength != -1 || len(got.transferEncoding) == 0 {
+				t.Errorf("expected a chunked body, got %+v", got)
+			}
+		})
+	}
+}
+
+func TestMultipart_ContentLengthMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	for _, size := range []int64{3, 100} {
+		_, err := httprequest.NewMultipart(context.Background(), http.Client{}, http.MethodPost, server.URL).
+			SizedFile("file", "f.bin", strings.NewReader(strings.Repeat("x", 10)), size).
+			Send()
+		if !errors.Is(err, httprequest.ErrContentLengthMismatch) {
+			t.Errorf("size %d: expected ErrContentLengthMismatch, got %v", size, err)
+		}
+	}
+}
+
+// openCountingFS tracks how many files of an fs.FS are open at once.
+type openCountingFS struct {
+	fs.FS
+	mu      sync.Mutex
+	open    int
+	maxOpen int
+}
+
+func (f *openCountingFS) Open(name string) (fs.File, error) {
+	file, err := f.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if info, _ := file.Stat(); info != nil && info.IsDir() {
+		return file, nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.open++
+	f.maxOpen = max(f.maxOpen, f.open)
+	return &countedFile{File: file, fs: f}, nil
+}
+
+type countedFile struct {
+	fs.File
+	fs *openCountingFS
+}
+
+func (c *countedFile) Close() error {
+	c.fs.mu.Lock()
+	c.fs.open--
+	c.fs.mu.Unlock()
+	return c.File.Close()
+}
+
+func TestMultipart_Dir(t *testing.T) {
+	var parts []receivedPart
+	var contentLength int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentLength = r.ContentLength
+		parts = readParts(t, r)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	fsys := &openCountingFS{FS: fstest.MapFS{
+		"build/app.js":           {Data: []byte("console.log(1)")},
+		"build/assets/logo.bin":  {Data: []byte{0x00, 0x01}},
+		"build/assets/style.css": {Data: []byte("body{}")},
+		"build/.cache/tmp":       {Data: []byte("skip me")},
+		"build/debug.map":        {Data: []byte("skip me too")},
+		"other/readme.txt":       {Data: []byte("outside root")},
+	}}
+
+	resp, err := httprequest.NewMultipart(context.Background(), http.Client{}, http.MethodPost, server.URL).
+		Param("release", "1.2.3").
+		Dir("artifacts", fsys, "build", func(path string, d fs.DirEntry) bool {
+			return !strings.HasPrefix(d.Name(), ".") && !strings.HasSuffix(path, ".map")
+		}).
+		Send()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	var files []string
+	for _, part := range parts[1:] {
+		_, params, _ := mime.ParseMediaType(part.header.Get("Content-Disposition"))
+		if part.name != "artifacts" {
+			t.Errorf("expected field artifacts, got %q", part.name)
+		}
+		files = append(files, params["filename"]+"="+part.body)
+	}
+	want := []string{"app.js=console.log(1)", "assets/logo.bin=\x00\x01", "assets/style.css=body{}"}
+	if strings.Join(files, "|") != strings.Join(want, "|") {
+		t.Errorf("expected files %q, got %q", want, files)
+	}
+	if ct := parts[3].header.Get("Content-Type"); !strings.HasPrefix(ct, "text/css") {
+		t.Errorf("expected text/css for style.css, got %q", ct)
+	}
+	if ct := parts[2].header.Get("Content-Type"); ct != "application/octet-stream" {
+		t.Errorf("expected application/octet-stream for logo.bin, got %q", ct)
+	}
+	if fsys.maxOpen != 1 || fsys.open != 0 {
+		t.Errorf("expected files to be opened one at a time and closed, got max %d, open %d", fsys.maxOpen, fsys.open)
+	}
+	if contentLength != -1 {
+		t.Errorf("expected a chunked body, got Content-Length %d", contentLength)
+	}
+}
+
+func TestMultipart_DirContentLength(t *testing.T) {
+	var contentLength int64
+	var bodyLength int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		contentLength, bodyLength = r.ContentLength, len(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	fsys := fstest.MapFS{
+		"build/app.js":    {Data: []byte("console.log(1)")},
+		"build/style.css": {Data: []byte("body{}")},
+	}
+	resp, err := httprequest.NewMultipart(context.Background(), http.Client{}, http.MethodPost, server.URL).
+		Dir("artifacts", fsys, "build", nil).
+		Nested("bundle", nil, func(p *httprequest.Parts) {
+			p.Dir("assets", fsys, "build", nil)
+		}).
+		ContentLength().
+		Send()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if contentLength <= 0 || contentLength != int64(bodyLength) {
+		t.Errorf("expected Content-Length %d, got %d", bodyLength, contentLength)
+	}
+}
+
+func TestMultipart_DirMissingRoot(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	_, err := httprequest.NewMultipart(context.Background(), http.Client{}, http.MethodPost, server.URL).
+		Dir("artifacts", fstest.MapFS{}, "build", nil).
+		Send()
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, got %v", err)
+	}
+}
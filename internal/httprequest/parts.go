@@ -0,0 +1,104 @@
+package httprequest
+
+import (
+	"io"
+	"io/fs"
+	"net/textproto"
+
+	"github.com/nativebpm/httpstream/internal/httpcodec"
+)
+
+// Parts builds the parts of a multipart body nested in a Multipart request.
+// It only adds parts and selects the subtype; request settings such as
+// headers, timeouts or compression belong to the enclosing Multipart.
+type Parts struct {
+	fields  []multipartField
+	subtype string
+	params  map[string]string
+}
+
+// Param adds a string field. See Multipart.Param.
+func (p *Parts) Param(key, value string) *Parts {
+	p.fields = append(p.fields, multipartField{contentType: multipartFormData, key: key, value: value})
+	return p
+}
+
+// File adds a file field. See Multipart.File.
+func (p *Parts) File(key, filename string, content io.Reader) *Parts {
+	p.fields = append(p.fields, multipartField{contentType: applicationOctetStream, key: key, value: filename, file: content})
+	return p
+}
+
+// SizedFile adds a file field whose content is size bytes long. See
+// Multipart.SizedFile.
+func (p *Parts) SizedFile(key, filename string, content io.Reader, size int64) *Parts {
+	p.fields = append(p.fields, multipartField{contentType: applicationOctetStream, key: key, value: filename, file: content, size: size, sized: true})
+	return p
+}
+
+// Dir adds a file field named key per regular file under root in fsys. See
+// Multipart.Dir.
+func (p *Parts) Dir(key string, fsys fs.FS, root string, filter func(path string, d fs.DirEntry) bool) *Parts {
+	p.fields = append(p.fields, multipartField{key: key, dir: &dirSource{fsys: fsys, root: root, filter: filter}})
+	return p
+}
+
+// FileWriter adds a file field whose content is the output of fn. See
+// Multipart.FileWriter.
+func (p *Parts) FileWriter(key, filename string, fn func(w io.Writer) error) *Parts {
+	p.fields = append(p.fields, multipartField{contentType: applicationOctetStream, key: key, value: filename, write: fn})
+	return p
+}
+
+// Part adds a part with arbitrary MIME headers. See Multipart.Part.
+func (p *Parts) Part(key, filename string, header textproto.MIMEHeader, content io.Reader) *Parts {
+	if header == nil {
+		header = make(textproto.MIMEHeader)
+	}
+	p.fields = append(p.fields, multipartField{key: key, value: filename, file: content, header: header})
+	return p
+}
+
+// JSON adds a field whose content is v encoded as JSON. See Multipart.JSON.
+func (p *Parts) JSON(key string, v any) *Parts {
+	return p.Encode(key, httpcodec.JSON{}, v)
+}
+
+// Encode adds a field whose content is v encoded with codec. See
+// Multipart.Encode.
+func (p *Parts) Encode(key string, codec httpcodec.Codec, v any) *Parts {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Type", codec.ContentType())
+	p.fields = append(p.fields, multipartField{key: key, header: header, write: func(w io.Writer) error {
+		return codec.Encode(w, v)
+	}})
+	return p
+}
+
+// Nested adds a part that is itself a multipart body. See Multipart.Nested.
+func (p *Parts) Nested(key string, header textproto.MIMEHeader, build func(p *Parts)) *Parts {
+	nested := &Parts{subtype: "mixed"}
+	build(nested)
+	if header == nil {
+		header = make(textproto.MIMEHeader)
+	}
+	p.fields = append(p.fields, multipartField{key: key, header: header, nested: nested, boundary: newBoundary()})
+	return p
+}
+
+// Related makes the body multipart/related. See Multipart.Related.
+func (p *Parts) Related(rootType, start string) *Parts {
+	p.subtype = "related"
+	p.params = map[string]string{"type": rootType}
+	if start != "" {
+		p.params["start"] = start
+	}
+	return p
+}
+
+// Mixed makes the body multipart/mixed. See Multipart.Mixed.
+func (p *Parts) Mixed() *Parts {
+	p.subtype = "mixed"
+	p.params = nil
+	return p
+}
@@ -9,6 +9,10 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/nativebpm/httpstream/internal/httpcodec"
+	"github.com/nativebpm/httpstream/internal/httpcompress"
+	"github.com/nativebpm/httpstream/internal/httpresponse"
 )
 
 // requestPayload represents the body payload for standard HTTP requests
@@ -16,14 +20,24 @@ type requestPayload struct {
 	contentType contentType
 	content     any
 	form        url.Values
+	source      Source
+	arrayKey    string
+	writer      func(w io.Writer) error
 }
 
 // Request provides a builder for standard HTTP requests.
 type Request struct {
 	*http.Request
-	client     http.Client
-	body       requestPayload
-	cancelFunc context.CancelFunc
+	client      http.Client
+	body        requestPayload
+	cancelFunc  context.CancelFunc
+	spoolCfg    *spoolConfig
+	spool       *spool
+	pipe        *io.PipeReader
+	expect      func(code int) bool
+	problems    *httpresponse.ProblemRegistry
+	codecs      *httpcodec.Registry
+	compression compression
 }
 
 // NewRequest creates a new HTTP request builder.
@@ -53,30 +67,46 @@ func (r *Request) Timeout(duration time.Duration) *Request {
 
 // Send executes the HTTP request and returns the response.
 func (r *Request) Send() (*http.Response, error) {
+	if err := r.compression.err; err != nil {
+		if release := r.release(); release != nil {
+			release()
+		}
+		return nil, err
+	}
+
 	ctx := r.Context()
+	if write := r.bodyWriter(ctx); write != nil {
+		r.pipe = pipeBody(ctx, r.compression.wrap(write))
+		r.Request.Body = r.pipe
+	}
+	r.compression.apply(r.Request)
+
+	return r.sendRequest()
+}
+
+// bodyWriter returns the producer of a streamed request body, or nil when
+// the body is sent as is.
+func (r *Request) bodyWriter(ctx context.Context) func(w io.Writer) error {
+	if r.body.writer != nil {
+		return r.body.writer
+	}
 
 	switch r.body.contentType {
 	case applicationJSON:
-		if r.body.content != nil {
-			pr, pw := io.Pipe()
-			r.Request.Body = pr
-
-			go func() {
-				defer pw.Close()
-
-				select {
-				case <-ctx.Done():
-					pw.CloseWithError(ctx.Err())
-					return
-				default:
-				}
-
-				encoder := json.NewEncoder(pw)
-				if err := encoder.Encode(r.body.content); err != nil {
-					pw.CloseWithError(err)
-					return
-				}
-			}()
+		if r.body.source != nil {
+			return func(w io.Writer) error {
+				return writeJSONArray(ctx, w, r.body.arrayKey, r.body.source)
+			}
+		} else if r.body.content != nil {
+			return func(w io.Writer) error {
+				return json.NewEncoder(w).Encode(r.body.content)
+			}
+		}
+	case applicationNDJSON:
+		if r.body.source != nil {
+			return func(w io.Writer) error {
+				return writeJSONLines(ctx, w, r.body.source)
+			}
 		}
 	case applicationUrlEncodedForm:
 		if r.body.form != nil {
@@ -84,24 +114,135 @@ func (r *Request) Send() (*http.Response, error) {
 		}
 	}
 
-	return r.sendRequest()
+	// Bodies set as readers are only piped when they have to be compressed.
+	if r.compression.enabled() && r.Request.Body != nil && r.Request.Body != http.NoBody {
+		return copyBody(r.Request.Body)
+	}
+	return nil
+}
+
+// Decode sends the request and stream-decodes the response body into v
+// with the codec registered for its Content-Type (JSON when no registry was
+// set), closing the body. Unless ExpectStatus was set, responses that are
+// not 2xx fail with a *StatusError; bodies that cannot be decoded fail with
+// a *DecodeError.
+func (r *Request) Decode(v any) error {
+	resp, err := r.sendExpectingSuccess()
+	if err != nil {
+		return err
+	}
+	return httpresponse.Decode(resp, r.codecs, v)
+}
+
+// DecodeWith is like Decode but always decodes the response body with
+// codec, failing with a *DecodeError when the codec does not accept the
+// response Content-Type.
+func (r *Request) DecodeWith(codec httpcodec.Codec, v any) error {
+	resp, err := r.sendExpectingSuccess()
+	if err != nil {
+		return err
+	}
+	return httpresponse.DecodeWith(resp, codec, v)
+}
+
+func (r *Request) sendExpectingSuccess() (*http.Response, error) {
+	if r.expect == nil {
+		r.expect = httpresponse.IsSuccess
+	}
+	return r.Send()
 }
 
 func (r *Request) sendRequest() (*http.Response, error) {
+	r.spool = spoolRequest(r.Request, r.spoolCfg)
 	resp, err := r.client.Do(r.Request)
+	release := r.release()
 	if err != nil {
-		if r.cancelFunc != nil {
-			r.cancelFunc()
+		if release != nil {
+			release()
 		}
 		return nil, err
 	}
-	if r.cancelFunc != nil {
-		resp.Body = &cancelCloser{resp.Body, r.cancelFunc}
-		r.cancelFunc = nil
+	if release != nil {
+		resp.Body = &cancelCloser{resp.Body, release}
+	}
+	if r.expect != nil && !r.expect(resp.StatusCode) {
+		return nil, httpresponse.NewStatusError(resp, r.problems)
 	}
 	return resp, nil
 }
 
+// release returns a function that cancels the request timeout, stops the
+// body producer and removes the spooled body, or nil when there is nothing
+// to release.
+func (r *Request) release() context.CancelFunc {
+	cancel, pipe, s := r.cancelFunc, r.pipe, r.spool
+	r.cancelFunc, r.pipe, r.spool = nil, nil, nil
+	return releaseFunc(cancel, pipe, s)
+}
+
+// Spool makes the request body rewindable. The body is teed into a buffer
+// that stays in memory up to maxMemory bytes and overflows to a temporary
+// file in dir (os.TempDir when empty), and GetBody is populated so redirects
+// and retries can re-send the same bytes without re-running the producer.
+// Spooled data is removed when the response body is closed.
+func (r *Request) Spool(maxMemory int64, dir string) *Request {
+	r.spoolCfg = &spoolConfig{maxMemory: maxMemory, dir: dir}
+	return r
+}
+
+// Compress streams the request body through a compressor for encoding,
+// "gzip" or "deflate", at level (see compress/gzip; 0 is the default),
+// sets Content-Encoding and drops Content-Length. Memory use stays bounded
+// by the compressor window. Send fails with ErrUnsupportedEncoding for
+// other encodings; use CompressWith for those.
+func (r *Request) Compress(encoding string, level int) *Request {
+	compressor, err := httpcompress.NewCompressor(encoding, level)
+	r.compression = compression{encoding: encoding, compressor: compressor, err: err}
+	return r
+}
+
+// CompressWith is like Compress for a content coding implemented by
+// compressor, such as zstd from a third-party package.
+func (r *Request) CompressWith(encoding string, compressor func(w io.Writer) (io.WriteCloser, error)) *Request {
+	r.compression = compression{encoding: encoding, compressor: compressor}
+	return r
+}
+
+// ExpectStatus makes Send fail with a *StatusError, after closing the
+// response body, when the response status is not one of codes.
+func (r *Request) ExpectStatus(codes ...int) *Request {
+	r.expect = func(code int) bool {
+		for _, c := range codes {
+			if c == code {
+				return true
+			}
+		}
+		return false
+	}
+	return r
+}
+
+// ExpectSuccess makes Send fail with a *StatusError, after closing the
+// response body, when the response status is not 2xx.
+func (r *Request) ExpectSuccess() *Request {
+	r.expect = httpresponse.IsSuccess
+	return r
+}
+
+// Problems sets the registry used to map problem+json documents of
+// unexpected responses to domain errors.
+func (r *Request) Problems(registry *httpresponse.ProblemRegistry) *Request {
+	r.problems = registry
+	return r
+}
+
+// Codecs sets the registry Decode uses to pick a codec by response
+// Content-Type.
+func (r *Request) Codecs(registry *httpcodec.Registry) *Request {
+	r.codecs = registry
+	return r
+}
+
 // Header sets an HTTP header on the request.
 func (r *Request) Header(key, value string) *Request {
 	r.Request.Header.Set(key, value)
@@ -162,18 +303,78 @@ func (r *Request) Body(body io.ReadCloser, contentType string) *Request {
 	return r
 }
 
+// BodyWriter sets the request body to the output of fn, which runs in the
+// producer goroutine feeding the request pipe. An error returned by fn
+// aborts the request. Writes fail once the request context is done or the
+// transport stops reading the body, so fn returns even when the server
+// closes the connection early.
+func (r *Request) BodyWriter(contentType string, fn func(w io.Writer) error) *Request {
+	r.Request.Header.Set("Content-Type", contentType)
+	r.body.writer = fn
+	return r
+}
+
+// Encode sets the request body to v encoded with codec, streamed through
+// the request pipe, and the Content-Type to the codec's.
+func (r *Request) Encode(codec httpcodec.Codec, v any) *Request {
+	return r.BodyWriter(codec.ContentType(), func(w io.Writer) error {
+		return codec.Encode(w, v)
+	})
+}
+
 // JSON sets the request body as JSON.
 func (r *Request) JSON(body any) *Request {
 	r.Request.Header.Set("Content-Type", string(applicationJSON))
 	r.body.contentType = applicationJSON
 	r.body.content = body
+	r.body.source = nil
+	r.body.writer = nil
 	return r
 }
 
+// JSONArray sets the request body as a JSON array whose elements are the
+// values produced by src, written through the pipe as they arrive.
+func (r *Request) JSONArray(src Source) *Request {
+	return r.JSONArrayField("", src)
+}
+
+// JSONArrayField sets the request body as a JSON object with a single
+// member key whose value is a streamed array of the values produced by src,
+// e.g. {"items":[...]}. An empty key streams a bare array.
+func (r *Request) JSONArrayField(key string, src Source) *Request {
+	r.Request.Header.Set("Content-Type", string(applicationJSON))
+	r.body.contentType = applicationJSON
+	r.body.content = nil
+	r.body.source = src
+	r.body.arrayKey = key
+	r.body.writer = nil
+	return r
+}
+
+// JSONLines sets the request body as newline-delimited JSON, encoding each
+// value produced by src on its own line as it arrives. An error returned by
+// src aborts the request, and encoding stops between records once the
+// request context is done.
+func (r *Request) JSONLines(src Source) *Request {
+	r.Request.Header.Set("Content-Type", string(applicationNDJSON))
+	r.body.contentType = applicationNDJSON
+	r.body.source = src
+	r.body.writer = nil
+	return r
+}
+
+// XML sets the request body as XML, streamed from encoding/xml through the
+// request pipe. Use Encode with an XML codec to write a prolog such as
+// xml.Header or to indent the output.
+func (r *Request) XML(body any) *Request {
+	return r.Encode(httpcodec.XML{}, body)
+}
+
 // Form sets the request body as form data.
 func (r *Request) Form(key, value string) *Request {
 	r.Request.Header.Set("Content-Type", string(applicationUrlEncodedForm))
 	r.body.contentType = applicationUrlEncodedForm
+	r.body.writer = nil
 	if r.body.form == nil {
 		r.body.form = make(url.Values)
 	}
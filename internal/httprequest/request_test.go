@@ -1,17 +1,26 @@
 package httprequest_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/nativebpm/httpstream/internal/httpcodec"
+	"github.com/nativebpm/httpstream/internal/httpcompress"
 	"github.com/nativebpm/httpstream/internal/httprequest"
+	"github.com/nativebpm/httpstream/internal/httpresponse"
 )
 
 func TestNewRequest(t *testing.T) {
@@ -657,3 +666,485 @@ func TestRequest_ComplexChaining(t *testing.T) {
 		t.Errorf("expected data name %s, got %s", data.Name, receivedData.Name)
 	}
 }
+
+func TestRequest_ExpectSuccess(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "abc")
+		http.Error(w, "user not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client := http.Client{}
+	ctx := context.Background()
+
+	resp, err := httprequest.NewRequest(ctx, client, http.MethodGet, server.URL+"/users/{id}").
+		PathInt("id", 7).
+		ExpectSuccess().
+		Send()
+
+	if resp != nil {
+		t.Errorf("expected nil response, got status %d", resp.StatusCode)
+	}
+
+	var statusErr *httpresponse.StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("expected *StatusError, got %v", err)
+	}
+	if statusErr.StatusCode != http.StatusNotFound || statusErr.Method != http.MethodGet {
+		t.Errorf("unexpected status error: %+v", statusErr)
+	}
+	if statusErr.URL != server.URL+"/users/7" {
+		t.Errorf("expected URL %s/users/7, got %s", server.URL, statusErr.URL)
+	}
+	if statusErr.Header.Get("X-Request-Id") != "abc" {
+		t.Errorf("expected response headers, got %v", statusErr.Header)
+	}
+	if string(statusErr.Body) != "user not found\n" {
+		t.Errorf("expected body snippet, got %q", statusErr.Body)
+	}
+}
+
+func TestRequest_ExpectStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	client := http.Client{}
+	ctx := context.Background()
+
+	resp, err := httprequest.NewRequest(ctx, client, http.MethodPost, server.URL).
+		ExpectStatus(http.StatusCreated, http.StatusAccepted).
+		Send()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	_, err = httprequest.NewRequest(ctx, client, http.MethodPost, server.URL).
+		ExpectStatus(http.StatusCreated).
+		Send()
+	var statusErr *httpresponse.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusAccepted {
+		t.Errorf("expected *StatusError with status 202, got %v", err)
+	}
+}
+
+func TestRequest_JSONLines(t *testing.T) {
+	type Record struct {
+		ID int `json:"id"`
+	}
+
+	var receivedContentType string
+	var received []Record
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedContentType = r.Header.Get("Content-Type")
+		decoder := json.NewDecoder(r.Body)
+		for decoder.More() {
+			var rec Record
+			if err := decoder.Decode(&rec); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			received = append(received, rec)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	records := make(chan Record)
+	go func() {
+		defer close(records)
+		for i := 1; i <= 3; i++ {
+			records <- Record{ID: i}
+		}
+	}()
+
+	client := http.Client{}
+	ctx := context.Background()
+
+	resp, err := httprequest.NewRequest(ctx, client, http.MethodPost, server.URL).
+		JSONLines(httprequest.FromChan(records)).
+		Send()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if receivedContentType != "application/x-ndjson" {
+		t.Errorf("expected Content-Type application/x-ndjson, got %s", receivedContentType)
+	}
+	if len(received) != 3 || received[0].ID != 1 || received[2].ID != 3 {
+		t.Errorf("expected 3 records, got %+v", received)
+	}
+}
+
+func TestRequest_JSONLinesProducerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	errProducer := errors.New("producer failed")
+	seq := func(yield func(int, error) bool) {
+		if yield(1, nil) {
+			yield(0, errProducer)
+		}
+	}
+
+	client := http.Client{}
+	ctx := context.Background()
+
+	_, err := httprequest.NewRequest(ctx, client, http.MethodPost, server.URL).
+		JSONLines(httprequest.FromSeq2(seq)).
+		Send()
+	if !errors.Is(err, errProducer) {
+		t.Errorf("expected producer error, got %v", err)
+	}
+}
+
+func TestRequest_JSONArray(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(*httprequest.Request, httprequest.Source) *httprequest.Request
+		expected string
+	}{
+		{
+			name:     "array",
+			setup:    func(r *httprequest.Request, src httprequest.Source) *httprequest.Request { return r.JSONArray(src) },
+			expected: `[{"id":1},{"id":2},{"id":3}]`,
+		},
+		{
+			name: "array_field",
+			setup: func(r *httprequest.Request, src httprequest.Source) *httprequest.Request {
+				return r.JSONArrayField("items", src)
+			},
+			expected: `{"items":[{"id":1},{"id":2},{"id":3}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var receivedBody string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				receivedBody = string(body)
+				if !json.Valid(body) {
+					http.Error(w, "invalid json", http.StatusBadRequest)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			seq := func(yield func(map[string]int) bool) {
+				for i := 1; i <= 3; i++ {
+					if !yield(map[string]int{"id": i}) {
+						return
+					}
+				}
+			}
+
+			client := http.Client{}
+			ctx := context.Background()
+
+			req := httprequest.NewRequest(ctx, client, http.MethodPost, server.URL)
+			resp, err := tt.setup(req, httprequest.FromSeq(seq)).Send()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("expected status 200, got %d", resp.StatusCode)
+			}
+			if receivedBody != tt.expected {
+				t.Errorf("expected body %s, got %s", tt.expected, receivedBody)
+			}
+		})
+	}
+}
+
+func TestRequest_BodyWriter(t *testing.T) {
+	var receivedBody, receivedContentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedContentType = r.Header.Get("Content-Type")
+		body, _ := io.ReadAll(r.Body)
+		receivedBody = string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := http.Client{}
+	ctx := context.Background()
+
+	resp, err := httprequest.NewRequest(ctx, client, http.MethodPost, server.URL).
+		BodyWriter("text/csv", func(w io.Writer) error {
+			for i := 1; i <= 3; i++ {
+				if _, err := io.WriteString(w, "row,"+strconv.Itoa(i)+"\n"); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).
+		Send()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if receivedContentType != "text/csv" {
+		t.Errorf("expected Content-Type text/csv, got %s", receivedContentType)
+	}
+	if receivedBody != "row,1\nrow,2\nrow,3\n" {
+		t.Errorf("unexpected body %q", receivedBody)
+	}
+}
+
+func TestRequest_BodyWriterExitsWhenServerStopsReading(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rejected", http.StatusRequestEntityTooLarge)
+	}))
+	defer server.Close()
+
+	done := make(chan error, 1)
+	client := http.Client{}
+	ctx := context.Background()
+
+	resp, err := httprequest.NewRequest(ctx, client, http.MethodPost, server.URL).
+		BodyWriter("application/octet-stream", func(w io.Writer) error {
+			chunk := make([]byte, 32<<10)
+			for {
+				if _, err := w.Write(chunk); err != nil {
+					done <- err
+					return err
+				}
+			}
+		}).
+		Send()
+	if err == nil {
+		resp.Body.Close()
+	}
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("expected write error after the server stopped reading")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("producer goroutine did not exit")
+	}
+}
+
+type csvCodec struct{}
+
+func (csvCodec) ContentType() string { return "text/csv" }
+
+func (csvCodec) Encode(w io.Writer, v any) error {
+	_, err := io.WriteString(w, strings.Join(v.([]string), ",")+"\n")
+	return err
+}
+
+func (csvCodec) Decode(r io.Reader, v any) error {
+	b, err := io.ReadAll(r)
+	*v.(*[]string) = strings.Split(strings.TrimSpace(string(b)), ",")
+	return err
+}
+
+func TestRequest_EncodeAndDecodeWithCodecs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		io.Copy(w, r.Body)
+	}))
+	defer server.Close()
+
+	client := http.Client{}
+	ctx := context.Background()
+
+	var got []string
+	err := httprequest.NewRequest(ctx, client, http.MethodPost, server.URL).
+		Codecs(httpcodec.NewRegistry(csvCodec{})).
+		Encode(csvCodec{}, []string{"a", "b", "c"}).
+		Decode(&got)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(got, "|") != "a|b|c" {
+		t.Errorf("unexpected decoded value %q", got)
+	}
+
+	err = httprequest.NewRequest(ctx, client, http.MethodPost, server.URL).
+		Encode(csvCodec{}, []string{"x"}).
+		DecodeWith(httpcodec.JSON{}, &got)
+	if !errors.Is(err, httpresponse.ErrUnexpectedContentType) {
+		t.Errorf("expected ErrUnexpectedContentType, got %v", err)
+	}
+}
+
+func TestRequest_XML(t *testing.T) {
+	var receivedBody, receivedContentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedContentType = r.Header.Get("Content-Type")
+		body, _ := io.ReadAll(r.Body)
+		receivedBody = string(body)
+		w.Header().Set("Content-Type", "text/xml")
+		io.WriteString(w, `<ack ok="true"/>`)
+	}))
+	defer server.Close()
+
+	type order struct {
+		XMLName xml.Name `xml:"order"`
+		ID      int      `xml:"id,attr"`
+	}
+	var ack struct {
+		OK bool `xml:"ok,attr"`
+	}
+	err := httprequest.NewRequest(context.Background(), http.Client{}, http.MethodPost, server.URL).
+		Codecs(httpcodec.NewRegistry(httpcodec.XML{})).
+		XML(order{ID: 42}).
+		Decode(&ack)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if receivedContentType != "application/xml" {
+		t.Errorf("expected Content-Type application/xml, got %s", receivedContentType)
+	}
+	if receivedBody != `<order id="42"></order>` {
+		t.Errorf("unexpected body %q", receivedBody)
+	}
+	if !ack.OK {
+		t.Error("expected ack to be decoded")
+	}
+}
+
+// decompressingServer records the Content-Encoding, Content-Length, wire
+// length and decoded body of each request it receives.
+type decompressingServer struct {
+	*httptest.Server
+	encoding      string
+	contentLength int64
+	wireLength    int
+	body          string
+}
+
+func newDecompressingServer(t *testing.T) *decompressingServer {
+	s := &decompressingServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.encoding, s.contentLength = r.Header.Get("Content-Encoding"), r.ContentLength
+		raw, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("read body: %v", err)
+		}
+		s.wireLength = len(raw)
+		var body io.Reader = bytes.NewReader(raw)
+		switch s.encoding {
+		case "gzip":
+			zr, err := gzip.NewReader(body)
+			if err != nil {
+				t.Errorf("gzip.NewReader: %v", err)
+				return
+			}
+			body = zr
+		case "deflate":
+			zr, err := zlib.NewReader(body)
+			if err != nil {
+				t.Errorf("zlib.NewReader: %v", err)
+				return
+			}
+			body = zr
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			t.Errorf("read body: %v", err)
+		}
+		s.body = string(data)
+		w.WriteHeader(http.StatusOK)
+	}))
+	return s
+}
+
+func TestRequest_Compress(t *testing.T) {
+	server := newDecompressingServer(t)
+	defer server.Close()
+
+	ctx := context.Background()
+	payload := strings.Repeat("compressible ", 1000)
+
+	tests := []struct {
+		name     string
+		encoding string
+		build    func(*httprequest.Request) *httprequest.Request
+		want     string
+	}{
+		{
+			name:     "gzip json",
+			encoding: "gzip",
+			build: func(r *httprequest.Request) *httprequest.Request {
+				return r.JSON(map[string]string{"text": payload}).Compress("gzip", gzip.BestSpeed)
+			},
+			want: `{"text":"` + payload + `"}` + "\n",
+		},
+		{
+			name:     "gzip default level",
+			encoding: "gzip",
+			build: func(r *httprequest.Request) *httprequest.Request {
+				return r.Body(io.NopCloser(strings.NewReader(payload)), "text/plain").Compress("gzip", 0)
+			},
+			want: payload,
+		},
+		{
+			name:     "deflate reader body",
+			encoding: "deflate",
+			build: func(r *httprequest.Request) *httprequest.Request {
+				r.Request.ContentLength = int64(len(payload))
+				return r.Body(io.NopCloser(strings.NewReader(payload)), "text/plain").Compress("deflate", gzip.DefaultCompression)
+			},
+			want: payload,
+		},
+		{
+			name:     "custom gzip writer",
+			encoding: "gzip",
+			build: func(r *httprequest.Request) *httprequest.Request {
+				return r.Form("text", "a b").CompressWith("gzip", func(w io.Writer) (io.WriteCloser, error) {
+					return gzip.NewWriter(w), nil
+				})
+			},
+			want: "text=a+b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.build(httprequest.NewRequest(ctx, http.Client{}, http.MethodPost, server.URL)).Send()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp.Body.Close()
+
+			if server.encoding != tt.encoding {
+				t.Errorf("expected Content-Encoding %s, got %q", tt.encoding, server.encoding)
+			}
+			if server.contentLength != -1 {
+				t.Errorf("expected unknown Content-Length, got %d", server.contentLength)
+			}
+			if server.body != tt.want {
+				t.Errorf("unexpected decompressed body of %d bytes", len(server.body))
+			}
+			if len(tt.want) > 1000 && server.wireLength >= len(tt.want)/2 {
+				t.Errorf("expected a compressed body, got %d bytes for %d", server.wireLength, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestRequest_CompressUnsupportedEncoding(t *testing.T) {
+	_, err := httprequest.NewRequest(context.Background(), http.Client{}, http.MethodPost, "http://example.com").
+		JSON(map[string]int{"id": 1}).
+		Compress("zstd", 3).
+		Send()
+	if !errors.Is(err, httpcompress.ErrUnsupportedEncoding) {
+		t.Errorf("expected ErrUnsupportedEncoding, got %v", err)
+	}
+}
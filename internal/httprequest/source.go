@@ -0,0 +1,61 @@
+package httprequest
+
+import "context"
+
+// Source produces the values of a streamed request body. It calls yield for
+// each value in order and returns nil when it is done, or the error that
+// should abort the request. When yield returns an error, because a value
+// could not be written or the request context is done, the Source must stop
+// and return it.
+type Source func(ctx context.Context, yield func(v any) error) error
+
+// FromChan returns a Source that yields the values received from ch until
+// it is closed. It stops waiting when the request context is done.
+func FromChan[T any](ch <-chan T) Source {
+	return func(ctx context.Context, yield func(any) error) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case v, ok := <-ch:
+				if !ok {
+					return nil
+				}
+				if err := yield(v); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// FromSeq returns a Source that yields the values of a push iterator, such
+// as an iter.Seq[T].
+func FromSeq[T any](seq func(yield func(T) bool)) Source {
+	return func(ctx context.Context, yield func(any) error) error {
+		var err error
+		seq(func(v T) bool {
+			err = yield(v)
+			return err == nil
+		})
+		return err
+	}
+}
+
+// FromSeq2 returns a Source that yields the values of a push iterator of
+// values and errors, such as an iter.Seq2[T, error]. The first error aborts
+// the request.
+func FromSeq2[T any](seq func(yield func(T, error) bool)) Source {
+	return func(ctx context.Context, yield func(any) error) error {
+		var err error
+		seq(func(v T, verr error) bool {
+			if verr != nil {
+				err = verr
+				return false
+			}
+			err = yield(v)
+			return err == nil
+		})
+		return err
+	}
+}
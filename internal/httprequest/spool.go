@@ -0,0 +1,171 @@
+package httprequest
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+var errSpoolReleased = errors.New("httpstream: spooled body was released")
+
+// spoolConfig holds the settings of a builder's Spool call.
+type spoolConfig struct {
+	maxMemory int64
+	dir       string
+}
+
+// spool tees a body that can only be read once into storage that is kept in
+// memory up to maxMemory bytes and overflows to a temporary file. Any number
+// of readers can then read the same bytes; data is pulled from the source
+// only when a reader reaches the end of what has been stored so far.
+type spool struct {
+	src       io.ReadCloser
+	maxMemory int64
+	dir       string
+
+	mu       sync.Mutex
+	mem      []byte
+	file     *os.File
+	size     int64
+	err      error
+	released bool
+}
+
+func newSpool(src io.ReadCloser, config *spoolConfig) *spool {
+	return &spool{src: src, maxMemory: config.maxMemory, dir: config.dir}
+}
+
+// spoolRequest replaces the body of req with a spooled reader and populates
+// GetBody, unless the body is empty or already rewindable.
+func spoolRequest(req *http.Request, config *spoolConfig) *spool {
+	if config == nil || req.Body == nil || req.Body == http.NoBody || req.GetBody != nil {
+		return nil
+	}
+	s := newSpool(req.Body, config)
+	req.Body = s.reader()
+	req.GetBody = func() (io.ReadCloser, error) { return s.reader(), nil }
+	return s
+}
+
+// reader returns a new reader positioned at the start of the body.
+func (s *spool) reader() io.ReadCloser {
+	return &spoolReader{spool: s}
+}
+
+func (s *spool) readAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.released {
+		return 0, errSpoolReleased
+	}
+	if off >= s.size {
+		if s.err != nil {
+			return 0, s.err
+		}
+		if err := s.fill(len(p)); err != nil {
+			return 0, err
+		}
+		if off >= s.size {
+			return 0, s.err
+		}
+	}
+
+	n := int64(len(p))
+	if rest := s.size - off; n > rest {
+		n = rest
+	}
+	if s.file != nil {
+		return s.file.ReadAt(p[:n], off)
+	}
+	return copy(p, s.mem[off:off+n]), nil
+}
+
+// fill reads the next chunk from the source and stores it. A source error,
+// including io.EOF, is recorded and reported to every reader that catches up.
+func (s *spool) fill(hint int) error {
+	if hint < 32<<10 {
+		hint = 32 << 10
+	}
+	chunk := make([]byte, hint)
+	n, err := s.src.Read(chunk)
+	if n > 0 {
+		if werr := s.store(chunk[:n]); werr != nil {
+			s.err = werr
+			return werr
+		}
+	}
+	if err != nil {
+		s.err = err
+	}
+	return nil
+}
+
+func (s *spool) store(p []byte) error {
+	if s.file == nil && s.size+int64(len(p)) <= s.maxMemory {
+		s.mem = append(s.mem, p...)
+		s.size += int64(len(p))
+		return nil
+	}
+	if s.file == nil {
+		file, err := os.CreateTemp(s.dir, "httpstream-spool-*")
+		if err != nil {
+			return err
+		}
+		if _, err := file.Write(s.mem); err != nil {
+			file.Close()
+			os.Remove(file.Name())
+			return err
+		}
+		s.file, s.mem = file, nil
+	}
+	if _, err := s.file.WriteAt(p, s.size); err != nil {
+		return err
+	}
+	s.size += int64(len(p))
+	return nil
+}
+
+// release closes the source and removes the temporary file, if any.
+func (s *spool) release() {
+	// Closing the source first unblocks a reader waiting in fill.
+	s.src.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.released {
+		return
+	}
+	s.released = true
+	s.mem = nil
+	if s.file != nil {
+		s.file.Close()
+		os.Remove(s.file.Name())
+		s.file = nil
+	}
+}
+
+// spoolReader is an independent cursor over a spool. Closing it does not
+// release the spool, so the transport can close one reader and ask for another.
+type spoolReader struct {
+	spool  *spool
+	offset int64
+}
+
+func (r *spoolReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n, err := r.spool.readAt(p, r.offset)
+	r.offset += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *spoolReader) Close() error {
+	return nil
+}
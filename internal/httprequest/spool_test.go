@@ -0,0 +1,94 @@
+package httprequest_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nativebpm/httpstream/internal/httprequest"
+)
+
+func TestRequest_SpoolFollowsRedirect(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			io.Copy(io.Discard, r.Body)
+			http.Redirect(w, r, "/new", http.StatusTemporaryRedirect)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	resp, err := httprequest.NewRequest(context.Background(), http.Client{}, http.MethodPost, server.URL+"/old").
+		JSON(map[string]string{"key": "value"}).
+		Spool(1<<20, "").
+		Send()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200, got %d", resp.StatusCode)
+	}
+	if received != `{"key":"value"}`+"\n" {
+		t.Errorf("expected JSON body after redirect, got %q", received)
+	}
+}
+
+func TestMultipart_SpoolOverflowsToDisk(t *testing.T) {
+	dir := t.TempDir()
+	content := strings.Repeat("x", 64<<10)
+
+	var sizes []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(file)
+		sizes = append(sizes, len(data))
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusPermanentRedirect)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	resp, err := httprequest.NewMultipart(context.Background(), http.Client{}, http.MethodPost, server.URL+"/old").
+		File("file", "data.txt", strings.NewReader(content)).
+		Spool(1024, dir).
+		Send()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(sizes) != 2 || sizes[0] != len(content) || sizes[1] != len(content) {
+		t.Errorf("expected file to be sent twice, got sizes %v", sizes)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected one spool file before close, got %d", len(entries))
+	}
+
+	resp.Body.Close()
+
+	entries, _ = os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("expected spool files to be removed, got %d", len(entries))
+	}
+}
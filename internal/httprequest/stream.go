@@ -0,0 +1,93 @@
+package httprequest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+)
+
+// writeJSONLines writes each value produced by src to w as a line of JSON.
+func writeJSONLines(ctx context.Context, w io.Writer, src Source) error {
+	encoder := json.NewEncoder(w)
+	return src(ctx, func(v any) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return encoder.Encode(v)
+	})
+}
+
+// writeJSONArray writes the values produced by src to w as a JSON array,
+// one element at a time. When key is not empty the array is wrapped in an
+// object as the value of key.
+func writeJSONArray(ctx context.Context, w io.Writer, key string, src Source) error {
+	open, end := "[", "]"
+	if key != "" {
+		name, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		open, end = "{"+string(name)+":[", "]}"
+	}
+
+	if _, err := io.WriteString(w, open); err != nil {
+		return err
+	}
+	separator := ""
+	err := src(ctx, func(v any) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, separator+string(data)); err != nil {
+			return err
+		}
+		separator = ","
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, end)
+	return err
+}
+
+// pipeBody runs write in a producer goroutine and returns the reading end
+// of the pipe it writes to. The error returned by write is propagated to
+// the reader. When ctx is done, the pipe is closed with the context error
+// so that blocked and subsequent writes fail.
+func pipeBody(ctx context.Context, write func(w io.Writer) error) *io.PipeReader {
+	pr, pw := io.Pipe()
+	go func() {
+		stop := context.AfterFunc(ctx, func() {
+			pr.CloseWithError(ctx.Err())
+		})
+		defer stop()
+
+		pw.CloseWithError(write(pw))
+	}()
+	return pr
+}
+
+// releaseFunc combines the resources held by a sent request into one
+// function, or returns nil when there is nothing to release. Closing the
+// pipe makes a producer that is still writing fail and exit.
+func releaseFunc(cancel context.CancelFunc, pipe *io.PipeReader, s *spool) context.CancelFunc {
+	if pipe == nil && s == nil {
+		return cancel
+	}
+	return func() {
+		if pipe != nil {
+			pipe.Close()
+		}
+		if s != nil {
+			s.release()
+		}
+		if cancel != nil {
+			cancel()
+		}
+	}
+}
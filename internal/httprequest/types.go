@@ -24,5 +24,6 @@ const (
 	applicationOctetStream    contentType = "application/octet-stream"
 	multipartFormData         contentType = "multipart/form-data"
 	applicationJSON           contentType = "application/json"
+	applicationNDJSON         contentType = "application/x-ndjson"
 	applicationUrlEncodedForm contentType = "application/x-www-form-urlencoded"
 )
@@ -0,0 +1,127 @@
+package httpresponse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/nativebpm/httpstream/internal/httpbody"
+)
+
+// DecodeArray returns an iterator over the elements of a JSON array in the
+// body of resp, decoded one at a time with json.Decoder.Token so memory use
+// is bounded by the largest element. When path is empty the array must be
+// the top-level value; otherwise path is a dot-separated list of object
+// keys leading to it, such as "data.items". Values before the array are
+// skipped token by token.
+//
+// Errors are yielded as a *DecodeError and end the iteration, as does
+// cancellation of the request context. The body is closed when the
+// iteration ends, including when the consumer stops early.
+func DecodeArray[T any](resp *http.Response, path string) func(yield func(T, error) bool) {
+	return func(yield func(T, error) bool) {
+		defer httpbody.DrainAndClose(resp.Body)
+
+		var zero T
+		if err := checkContentType(resp, isJSON); err != nil {
+			yield(zero, err)
+			return
+		}
+
+		ctx := context.Background()
+		if resp.Request != nil {
+			ctx = resp.Request.Context()
+		}
+
+		dec := json.NewDecoder(resp.Body)
+		if err := seekArray(dec, path); err != nil {
+			yield(zero, newDecodeError(resp, err))
+			return
+		}
+		for dec.More() {
+			if err := ctx.Err(); err != nil {
+				yield(zero, err)
+				return
+			}
+			var v T
+			if err := dec.Decode(&v); err != nil {
+				if ctx.Err() != nil {
+					err = ctx.Err()
+				} else {
+					err = newDecodeError(resp, err)
+				}
+				yield(zero, err)
+				return
+			}
+			if !yield(v, nil) {
+				return
+			}
+		}
+	}
+}
+
+// seekArray advances dec past the opening bracket of the array at path.
+func seekArray(dec *json.Decoder, path string) error {
+	if path != "" {
+		for _, key := range strings.Split(path, ".") {
+			if err := seekKey(dec, key); err != nil {
+				return fmt.Errorf("json path %q: %w", path, err)
+			}
+		}
+	}
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != json.Delim('[') {
+		return fmt.Errorf("json path %q: expected array, got %v", path, tok)
+	}
+	return nil
+}
+
+// seekKey advances dec past the key of the next object, skipping the
+// values of preceding members.
+func seekKey(dec *json.Decoder, key string) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != json.Delim('{') {
+		return fmt.Errorf("expected object, got %v", tok)
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if tok == key {
+			return nil
+		}
+		if err := skipValue(dec); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("key %q not found", key)
+}
+
+// skipValue consumes the next value of dec without retaining it.
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
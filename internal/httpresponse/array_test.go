@@ -0,0 +1,82 @@
+package httpresponse_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/nativebpm/httpstream/internal/httpresponse"
+)
+
+func TestDecodeArray(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		body string
+	}{
+		{name: "top level", path: "", body: `[{"id":1},{"id":2},{"id":3}]`},
+		{
+			name: "nested path",
+			path: "data.items",
+			body: `{"meta":{"skip":[1,{"a":[]}]},"data":{"total":3,"items":[{"id":1},{"id":2},{"id":3}]},"next":null}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := &closeRecorder{Reader: strings.NewReader(tt.body)}
+			resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Content-Type": {"application/json"}}, Body: body}
+
+			var ids []int
+			httpresponse.DecodeArray[record](resp, tt.path)(func(r record, err error) bool {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				ids = append(ids, r.ID)
+				return true
+			})
+
+			if fmt.Sprint(ids) != "[1 2 3]" {
+				t.Errorf("expected records [1 2 3], got %v", ids)
+			}
+			if !body.closed {
+				t.Error("expected body to be closed")
+			}
+		})
+	}
+}
+
+func TestDecodeArray_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		body string
+	}{
+		{name: "missing key", path: "data.items", body: `{"data":{"rows":[]}}`},
+		{name: "not an array", path: "", body: `{"id":1}`},
+		{name: "truncated element", path: "", body: `[{"id":1},{"id":`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body:       &closeRecorder{Reader: strings.NewReader(tt.body)},
+			}
+
+			var last error
+			httpresponse.DecodeArray[record](resp, tt.path)(func(_ record, err error) bool {
+				last = err
+				return true
+			})
+
+			var decodeErr *httpresponse.DecodeError
+			if !errors.As(last, &decodeErr) {
+				t.Errorf("expected *DecodeError, got %v", last)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package httpresponse
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/nativebpm/httpstream/internal/httpbody"
+	"github.com/nativebpm/httpstream/internal/httpcodec"
+)
+
+// ErrUnexpectedContentType reports a response whose Content-Type does not
+// match the decoder.
+var ErrUnexpectedContentType = errors.New("httpstream: unexpected response content type")
+
+// DecodeError reports a response body that could not be decoded. It keeps
+// the response status so failures can be told apart from transport errors,
+// and the 1-based line of the failing record for line-delimited bodies.
+type DecodeError struct {
+	StatusCode  int
+	Status      string
+	ContentType string
+	Line        int
+	Err         error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("decode response (status %d, content type %q) line %d: %v", e.StatusCode, e.ContentType, e.Line, e.Err)
+	}
+	return fmt.Sprintf("decode response (status %d, content type %q): %v", e.StatusCode, e.ContentType, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeJSON stream-decodes the JSON body of resp into v and closes the
+// body. It fails with a *DecodeError when the Content-Type is not JSON or
+// the body cannot be decoded.
+func DecodeJSON(resp *http.Response, v any) error {
+	return DecodeWith(resp, httpcodec.JSON{}, v)
+}
+
+// DecodeWith stream-decodes the body of resp into v with codec and closes
+// the body. It fails with a *DecodeError when the codec does not accept the
+// Content-Type or the body cannot be decoded.
+func DecodeWith(resp *http.Response, codec httpcodec.Codec, v any) error {
+	defer httpbody.DrainAndClose(resp.Body)
+
+	if !httpcodec.Accepts(codec, resp.Header.Get("Content-Type")) {
+		return newDecodeError(resp, ErrUnexpectedContentType)
+	}
+	if err := codec.Decode(resp.Body, v); err != nil {
+		return newDecodeError(resp, err)
+	}
+	return nil
+}
+
+// Decode stream-decodes the body of resp into v with the codec registered
+// for its Content-Type and closes the body. A nil registry decodes JSON
+// only. It fails with a *DecodeError when no codec is registered for the
+// Content-Type or the body cannot be decoded.
+func Decode(resp *http.Response, codecs *httpcodec.Registry, v any) error {
+	codec, ok := codecs.Lookup(resp.Header.Get("Content-Type"))
+	if !ok {
+		httpbody.DrainAndClose(resp.Body)
+		return newDecodeError(resp, ErrUnexpectedContentType)
+	}
+	return DecodeWith(resp, codec, v)
+}
+
+func newDecodeError(resp *http.Response, err error) *DecodeError {
+	return &DecodeError{
+		StatusCode:  resp.StatusCode,
+		Status:      resp.Status,
+		ContentType: resp.Header.Get("Content-Type"),
+		Err:         err,
+	}
+}
+
+// checkContentType fails with a *DecodeError wrapping
+// ErrUnexpectedContentType unless match accepts the response media type.
+func checkContentType(resp *http.Response, match func(mediaType string) bool) error {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || !match(mediaType) {
+		return newDecodeError(resp, ErrUnexpectedContentType)
+	}
+	return nil
+}
+
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
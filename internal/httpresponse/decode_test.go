@@ -0,0 +1,81 @@
+package httpresponse_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/nativebpm/httpstream/internal/httpcodec"
+	"github.com/nativebpm/httpstream/internal/httpresponse"
+)
+
+func jsonResponse(contentType, body string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Header:     http.Header{"Content-Type": {contentType}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	var v struct {
+		Name string `json:"name"`
+	}
+	resp := jsonResponse("application/vnd.api+json; charset=utf-8", `{"name":"gopher"}`)
+	if err := httpresponse.DecodeJSON(resp, &v); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v.Name != "gopher" {
+		t.Errorf("expected name gopher, got %q", v.Name)
+	}
+}
+
+func TestDecodeJSON_Errors(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantErr     error
+	}{
+		{name: "wrong content type", contentType: "text/html", body: "<html>", wantErr: httpresponse.ErrUnexpectedContentType},
+		{name: "missing content type", contentType: "", body: "{}", wantErr: httpresponse.ErrUnexpectedContentType},
+		{name: "invalid json", contentType: "application/json", body: `{"name":`, wantErr: io.ErrUnexpectedEOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v map[string]any
+			err := httpresponse.DecodeJSON(jsonResponse(tt.contentType, tt.body), &v)
+
+			var decodeErr *httpresponse.DecodeError
+			if !errors.As(err, &decodeErr) || decodeErr.StatusCode != http.StatusOK {
+				t.Fatalf("expected *DecodeError with status 200, got %v", err)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDecode_Registry(t *testing.T) {
+	var v map[string]any
+	err := httpresponse.Decode(jsonResponse("application/problem+json", `{"title":"x"}`), nil, &v)
+	if err != nil || v["title"] != "x" {
+		t.Fatalf("expected JSON decoded with nil registry, got %v, %v", v, err)
+	}
+
+	body := &closeRecorder{Reader: strings.NewReader("a,b")}
+	resp := jsonResponse("text/csv", "")
+	resp.Body = body
+	err = httpresponse.Decode(resp, httpcodec.NewRegistry(httpcodec.JSON{}), &v)
+	if !errors.Is(err, httpresponse.ErrUnexpectedContentType) {
+		t.Errorf("expected ErrUnexpectedContentType, got %v", err)
+	}
+	if !body.closed {
+		t.Error("expected body to be closed")
+	}
+}
@@ -0,0 +1,80 @@
+package httpresponse
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/nativebpm/httpstream/internal/httpbody"
+)
+
+// DecodeLines returns an iterator over the records of a newline-delimited
+// JSON (NDJSON, JSON Lines) response body. Records are decoded one at a
+// time, so memory use is bounded by the largest record. Blank lines are
+// skipped. A response whose Content-Type is not application/x-ndjson,
+// application/jsonl or JSON yields a single *DecodeError wrapping
+// ErrUnexpectedContentType.
+//
+// A record that cannot be decoded is yielded as a *DecodeError carrying its
+// line number; iteration continues with the next line if the consumer keeps
+// going. Read errors end the iteration, and so does cancellation of the
+// request context, which is yielded as the context error. The body is
+// closed when the iteration ends, including when the consumer stops early.
+func DecodeLines[T any](resp *http.Response) func(yield func(T, error) bool) {
+	return func(yield func(T, error) bool) {
+		defer httpbody.DrainAndClose(resp.Body)
+
+		var zero T
+		if err := checkContentType(resp, isJSONLines); err != nil {
+			yield(zero, err)
+			return
+		}
+
+		ctx := context.Background()
+		if resp.Request != nil {
+			ctx = resp.Request.Context()
+		}
+
+		reader := bufio.NewReader(resp.Body)
+		for line := 1; ; line++ {
+			if err := ctx.Err(); err != nil {
+				yield(zero, err)
+				return
+			}
+
+			data, err := reader.ReadBytes('\n')
+			if len(bytes.TrimSpace(data)) > 0 && (err == nil || err == io.EOF) {
+				var v T
+				if derr := json.Unmarshal(data, &v); derr != nil {
+					decodeErr := newDecodeError(resp, derr)
+					decodeErr.Line = line
+					if !yield(zero, decodeErr) {
+						return
+					}
+				} else if !yield(v, nil) {
+					return
+				}
+			}
+
+			switch {
+			case err == io.EOF:
+				return
+			case err != nil && ctx.Err() != nil:
+				yield(zero, ctx.Err())
+				return
+			case err != nil:
+				decodeErr := newDecodeError(resp, err)
+				decodeErr.Line = line
+				yield(zero, decodeErr)
+				return
+			}
+		}
+	}
+}
+
+func isJSONLines(mediaType string) bool {
+	return mediaType == "application/x-ndjson" || mediaType == "application/jsonl" || isJSON(mediaType)
+}
@@ -0,0 +1,114 @@
+package httpresponse_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nativebpm/httpstream/internal/httpresponse"
+)
+
+type record struct {
+	ID int `json:"id"`
+}
+
+func TestDecodeLines(t *testing.T) {
+	body := &closeRecorder{Reader: strings.NewReader("{\"id\":1}\n\n{\"id\":2}\r\n{\"id\":\n{\"id\":4}")}
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Content-Type": {"application/x-ndjson"}}, Body: body}
+
+	var ids []int
+	var lineErr *httpresponse.DecodeError
+	httpresponse.DecodeLines[record](resp)(func(r record, err error) bool {
+		if err != nil {
+			if !errors.As(err, &lineErr) {
+				t.Errorf("expected *DecodeError, got %v", err)
+			}
+			return true
+		}
+		ids = append(ids, r.ID)
+		return true
+	})
+
+	if fmt.Sprint(ids) != "[1 2 4]" {
+		t.Errorf("expected records [1 2 4], got %v", ids)
+	}
+	if lineErr == nil || lineErr.Line != 4 {
+		t.Errorf("expected decode error on line 4, got %v", lineErr)
+	}
+	if !body.closed {
+		t.Error("expected body to be closed")
+	}
+}
+
+func TestDecodeLines_StopsEarly(t *testing.T) {
+	body := &closeRecorder{Reader: strings.NewReader("{\"id\":1}\n{\"id\":2}\n")}
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Content-Type": {"application/x-ndjson"}}, Body: body}
+
+	count := 0
+	httpresponse.DecodeLines[record](resp)(func(record, error) bool {
+		count++
+		return false
+	})
+
+	if count != 1 || !body.closed {
+		t.Errorf("expected one record and a closed body, got %d records (closed=%v)", count, body.closed)
+	}
+}
+
+func TestDecodeLines_UnexpectedContentType(t *testing.T) {
+	body := &closeRecorder{Reader: strings.NewReader("<html>\n<body>Bad Gateway</body>\n</html>\n")}
+	resp := &http.Response{StatusCode: http.StatusBadGateway, Header: http.Header{"Content-Type": {"text/html"}}, Body: body}
+
+	var errs []error
+	httpresponse.DecodeLines[record](resp)(func(r record, err error) bool {
+		errs = append(errs, err)
+		return true
+	})
+
+	var decodeErr *httpresponse.DecodeError
+	if len(errs) != 1 || !errors.Is(errs[0], httpresponse.ErrUnexpectedContentType) || !errors.As(errs[0], &decodeErr) {
+		t.Errorf("expected a single ErrUnexpectedContentType DecodeError, got %v", errs)
+	}
+	if !body.closed {
+		t.Error("expected body to be closed")
+	}
+}
+
+func TestDecodeLines_ContextCancellation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/jsonl")
+		w.Write([]byte("{\"id\":1}\n"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var last error
+	httpresponse.DecodeLines[record](resp)(func(r record, err error) bool {
+		if err == nil {
+			cancel()
+		}
+		last = err
+		return true
+	})
+
+	if !errors.Is(last, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", last)
+	}
+	if _, err := resp.Body.Read(make([]byte, 1)); err == nil || err == io.EOF {
+		t.Errorf("expected body to be closed, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package httpresponse
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"sync"
+)
+
+// maxProblem bounds the number of body bytes decoded as a problem document.
+const maxProblem = 64 << 10
+
+const applicationProblemJSON = "application/problem+json"
+
+// Problem is an RFC 9457 problem details document. Members other than the
+// standard ones are kept in Extensions. When the problem type is registered
+// in a ProblemRegistry, Unwrap returns the mapped domain error.
+type Problem struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]any
+
+	err error
+}
+
+func (p *Problem) Error() string {
+	msg := p.Title
+	if msg == "" {
+		msg = p.Type
+	}
+	if p.Detail != "" {
+		msg += ": " + p.Detail
+	}
+	return msg
+}
+
+func (p *Problem) Unwrap() error {
+	return p.err
+}
+
+func (p *Problem) UnmarshalJSON(data []byte) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+
+	standard := map[string]any{
+		"type":     &p.Type,
+		"title":    &p.Title,
+		"status":   &p.Status,
+		"detail":   &p.Detail,
+		"instance": &p.Instance,
+	}
+	for name, raw := range members {
+		if target, ok := standard[name]; ok {
+			// Members of the wrong type are ignored, as RFC 9457 requires.
+			_ = json.Unmarshal(raw, target)
+			continue
+		}
+		var value any
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return err
+		}
+		if p.Extensions == nil {
+			p.Extensions = make(map[string]any)
+		}
+		p.Extensions[name] = value
+	}
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	return nil
+}
+
+// ProblemRegistry maps problem type URIs to domain errors. It is safe for
+// concurrent use.
+type ProblemRegistry struct {
+	mu    sync.RWMutex
+	types map[string]func(*Problem) error
+}
+
+// NewProblemRegistry creates an empty ProblemRegistry.
+func NewProblemRegistry() *ProblemRegistry {
+	return &ProblemRegistry{types: make(map[string]func(*Problem) error)}
+}
+
+// Register maps problems of typeURI to the error returned by fn, which the
+// Problem then wraps so callers can use errors.As with their own types.
+func (r *ProblemRegistry) Register(typeURI string, fn func(*Problem) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.types[typeURI] = fn
+}
+
+func (r *ProblemRegistry) resolve(p *Problem) {
+	if r == nil {
+		return
+	}
+	r.mu.RLock()
+	fn, ok := r.types[p.Type]
+	r.mu.RUnlock()
+	if ok {
+		p.err = fn(p)
+	}
+}
+
+// isProblem reports whether the response carries a problem+json document.
+func isProblem(header http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	return err == nil && mediaType == applicationProblemJSON
+}
+
+// decodeProblem decodes a problem document, or returns nil when data is not
+// a valid one.
+func decodeProblem(data []byte, registry *ProblemRegistry) *Problem {
+	p := new(Problem)
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil
+	}
+	registry.resolve(p)
+	return p
+}
@@ -0,0 +1,65 @@
+package httpresponse_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/nativebpm/httpstream/internal/httpresponse"
+)
+
+type outOfCreditError struct {
+	Balance float64
+}
+
+func (e *outOfCreditError) Error() string {
+	return "out of credit"
+}
+
+func TestProblem_UnmarshalJSON(t *testing.T) {
+	var p httpresponse.Problem
+	data := `{"title":"Out of credit","status":403,"detail":"Balance is 30","balance":30,"accounts":["/a/1"]}`
+	if err := json.Unmarshal([]byte(data), &p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if p.Type != "about:blank" || p.Title != "Out of credit" || p.Status != 403 || p.Detail != "Balance is 30" {
+		t.Errorf("unexpected standard members: %+v", p)
+	}
+	if p.Extensions["balance"] != 30.0 || len(p.Extensions["accounts"].([]any)) != 1 {
+		t.Errorf("unexpected extensions: %v", p.Extensions)
+	}
+	if p.Error() != "Out of credit: Balance is 30" {
+		t.Errorf("unexpected message: %q", p.Error())
+	}
+}
+
+func TestNewStatusError_Problem(t *testing.T) {
+	registry := httpresponse.NewProblemRegistry()
+	registry.Register("https://example.com/probs/out-of-credit", func(p *httpresponse.Problem) error {
+		balance, _ := p.Extensions["balance"].(float64)
+		return &outOfCreditError{Balance: balance}
+	})
+
+	resp := &http.Response{
+		StatusCode: http.StatusForbidden,
+		Header:     http.Header{"Content-Type": {"application/problem+json; charset=utf-8"}},
+		Body: io.NopCloser(strings.NewReader(
+			`{"type":"https://example.com/probs/out-of-credit","title":"Out of credit","balance":30}`)),
+		Request: &http.Request{Method: http.MethodPost, URL: mustURL(t, "https://example.com/pay")},
+	}
+
+	var err error = httpresponse.NewStatusError(resp, registry)
+
+	var problem *httpresponse.Problem
+	if !errors.As(err, &problem) || problem.Title != "Out of credit" {
+		t.Fatalf("expected *Problem, got %v", err)
+	}
+	var domain *outOfCreditError
+	if !errors.As(err, &domain) || domain.Balance != 30 {
+		t.Errorf("expected *outOfCreditError with balance 30, got %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package httpresponse
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxSnippet bounds the number of body bytes kept by a StatusError.
+const maxSnippet = 4 << 10
+
+// StatusError reports a response whose status code was not expected. The
+// response body is closed; Body holds at most its first 4 KiB. When the
+// response is an application/problem+json document, Problem holds it
+// decoded and is returned by Unwrap.
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Body       []byte
+	Problem    *Problem
+}
+
+// NewStatusError reads a bounded snippet of the body of resp, closes the
+// body and returns a StatusError describing resp. Problem documents are
+// decoded and resolved against registry, which may be nil.
+func NewStatusError(resp *http.Response, registry *ProblemRegistry) *StatusError {
+	e := &StatusError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Header:     resp.Header,
+	}
+	if resp.Request != nil {
+		e.Method = resp.Request.Method
+		e.URL = resp.Request.URL.Redacted()
+	}
+	if resp.Body == nil {
+		return e
+	}
+	defer resp.Body.Close()
+
+	if !isProblem(resp.Header) {
+		e.Body, _ = io.ReadAll(io.LimitReader(resp.Body, maxSnippet))
+		return e
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxProblem))
+	e.Problem = decodeProblem(data, registry)
+	e.Body = data[:min(len(data), maxSnippet)]
+	return e
+}
+
+func (e *StatusError) Error() string {
+	status := e.Status
+	if status == "" {
+		status = fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("%s %s: unexpected status %s", e.Method, e.URL, status)
+}
+
+func (e *StatusError) Unwrap() error {
+	if e.Problem == nil {
+		return nil
+	}
+	return e.Problem
+}
+
+// IsSuccess reports whether code is a 2xx status code.
+func IsSuccess(code int) bool {
+	return code >= 200 && code < 300
+}
@@ -0,0 +1,80 @@
+package httpresponse
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/nativebpm/httpstream/internal/httpbody"
+	"github.com/nativebpm/httpstream/internal/httpcodec"
+)
+
+// DecodeXML stream-decodes the XML body of resp into v and closes the
+// body. It fails with a *DecodeError when the Content-Type is not XML or
+// the body cannot be decoded.
+func DecodeXML(resp *http.Response, v any) error {
+	return DecodeWith(resp, httpcodec.XML{}, v)
+}
+
+// DecodeXMLElements returns an iterator over the elements with local name
+// name in the XML body of resp, wherever they occur in the document. The
+// body is read token by token and each element is decoded into a new T
+// with xml.Decoder.DecodeElement, so memory use is bounded by the largest
+// element. Elements nested inside a yielded element are part of it and are
+// not yielded again.
+//
+// Errors are yielded as a *DecodeError and end the iteration, as does
+// cancellation of the request context. The body is closed when the
+// iteration ends, including when the consumer stops early.
+func DecodeXMLElements[T any](resp *http.Response, name string) func(yield func(T, error) bool) {
+	return func(yield func(T, error) bool) {
+		defer httpbody.DrainAndClose(resp.Body)
+
+		var zero T
+		if err := checkContentType(resp, httpcodec.IsXML); err != nil {
+			yield(zero, err)
+			return
+		}
+
+		ctx := context.Background()
+		if resp.Request != nil {
+			ctx = resp.Request.Context()
+		}
+
+		dec := xml.NewDecoder(resp.Body)
+		for {
+			if err := ctx.Err(); err != nil {
+				yield(zero, err)
+				return
+			}
+
+			tok, err := dec.Token()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err == nil {
+				start, ok := tok.(xml.StartElement)
+				if !ok || start.Name.Local != name {
+					continue
+				}
+				var v T
+				if err = dec.DecodeElement(&v, &start); err == nil {
+					if !yield(v, nil) {
+						return
+					}
+					continue
+				}
+			}
+
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			} else {
+				err = newDecodeError(resp, err)
+			}
+			yield(zero, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package httpresponse_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/nativebpm/httpstream/internal/httpresponse"
+)
+
+type item struct {
+	ID   int    `xml:"id,attr"`
+	Name string `xml:"name"`
+}
+
+func xmlResponse(body string) (*http.Response, *closeRecorder) {
+	rec := &closeRecorder{Reader: strings.NewReader(body)}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/xml; charset=utf-8"}},
+		Body:       rec,
+	}, rec
+}
+
+func TestDecodeXML(t *testing.T) {
+	resp, body := xmlResponse(`<?xml version="1.0"?><item id="7"><name>gopher</name></item>`)
+
+	var v item
+	if err := httpresponse.DecodeXML(resp, &v); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v.ID != 7 || v.Name != "gopher" {
+		t.Errorf("unexpected item %+v", v)
+	}
+	if !body.closed {
+		t.Error("expected body to be closed")
+	}
+}
+
+func TestDecodeXMLElements(t *testing.T) {
+	resp, body := xmlResponse(`<feed><meta><item id="0"/></meta>` +
+		`<entries><item id="1"><name>a</name></item><item id="2"><name>b</name></item></entries>` +
+		`<item id="3"><name>c</name></item></feed>`)
+
+	var ids []int
+	httpresponse.DecodeXMLElements[item](resp, "item")(func(v item, err error) bool {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		ids = append(ids, v.ID)
+		return true
+	})
+
+	if fmt.Sprint(ids) != "[0 1 2 3]" {
+		t.Errorf("expected items [0 1 2 3], got %v", ids)
+	}
+	if !body.closed {
+		t.Error("expected body to be closed")
+	}
+}
+
+func TestDecodeXMLElements_StopEarly(t *testing.T) {
+	resp, body := xmlResponse(`<feed><item id="1"/><item id="2"/><item id="3"/></feed>`)
+
+	var count int
+	httpresponse.DecodeXMLElements[item](resp, "item")(func(item, error) bool {
+		count++
+		return false
+	})
+
+	if count != 1 || !body.closed {
+		t.Errorf("expected one item and a closed body, got %d, closed=%v", count, body.closed)
+	}
+}
+
+func TestDecodeXMLElements_Errors(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantErr     error
+	}{
+		{name: "wrong content type", contentType: "application/json", body: `{}`, wantErr: httpresponse.ErrUnexpectedContentType},
+		{name: "truncated element", contentType: "application/atom+xml", body: `<feed><item id="1"/><item id="2"><na`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, _ := xmlResponse(tt.body)
+			resp.Header.Set("Content-Type", tt.contentType)
+
+			var last error
+			httpresponse.DecodeXMLElements[item](resp, "item")(func(_ item, err error) bool {
+				last = err
+				return true
+			})
+
+			var decodeErr *httpresponse.DecodeError
+			if !errors.As(last, &decodeErr) {
+				t.Fatalf("expected *DecodeError, got %v", last)
+			}
+			if tt.wantErr != nil && !errors.Is(last, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, last)
+			}
+		})
+	}
+}
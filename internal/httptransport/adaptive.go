@@ -0,0 +1,279 @@
+package httptransport
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// LimitSample describes one completed request observed by an adaptive
+// limiter.
+type LimitSample struct {
+	// RTT is the time from sending the request to receiving the response
+	// headers or an error.
+	RTT time.Duration
+
+	// InFlight is the number of requests in flight when the request started,
+	// including itself.
+	InFlight int
+
+	// Dropped reports that the upstream signalled overload: a timeout, a 429
+	// or a 503.
+	Dropped bool
+}
+
+// LimitAlgorithm computes the next concurrency limit from the current limit
+// and a sample. Calls to Update are serialized by the limiter.
+type LimitAlgorithm interface {
+	Update(limit int, sample LimitSample) int
+}
+
+// AIMD grows the limit additively while requests succeed and shrinks it
+// multiplicatively when a request is dropped.
+type AIMD struct {
+	// Increase is added to the limit after a successful request that used at
+	// least half of the current limit. Defaults to 1.
+	Increase int
+
+	// Backoff multiplies the limit after a drop. Defaults to 0.9.
+	Backoff float64
+}
+
+func (a *AIMD) Update(limit int, sample LimitSample) int {
+	if sample.Dropped {
+		backoff := a.Backoff
+		if backoff <= 0 || backoff >= 1 {
+			backoff = 0.9
+		}
+		return int(float64(limit) * backoff)
+	}
+	// Only grow when the limit is actually the bottleneck.
+	if sample.InFlight*2 < limit {
+		return limit
+	}
+	increase := a.Increase
+	if increase <= 0 {
+		increase = 1
+	}
+	return limit + increase
+}
+
+// Gradient is a Vegas-style algorithm. It averages RTTs over a long window
+// as the baseline latency and scales the limit by the ratio between that
+// baseline and the latest RTT, so the limit grows while latency stays flat
+// and shrinks as soon as requests start queueing upstream. Because the
+// baseline follows lasting latency changes, such as a deploy or a region
+// failover, the limit recovers once latency stabilizes at a new level.
+type Gradient struct {
+	// Tolerance is the RTT inflation accepted before the limit shrinks, as a
+	// multiple of the baseline. Defaults to 1.5.
+	Tolerance float64
+
+	// QueueSize is the headroom added to the limit on each update, allowing
+	// it to grow. Defaults to 4.
+	QueueSize int
+
+	// Smoothing weighs the new estimate against the current limit, between 0
+	// and 1. Defaults to 0.2.
+	Smoothing float64
+
+	// Backoff multiplies the limit after a drop. Defaults to 0.5.
+	Backoff float64
+
+	// Window is the number of samples the baseline is averaged over.
+	// Defaults to 600.
+	Window int
+
+	baseline float64
+	samples  int
+}
+
+func (g *Gradient) Update(limit int, sample LimitSample) int {
+	if sample.Dropped {
+		backoff := g.Backoff
+		if backoff <= 0 || backoff >= 1 {
+			backoff = 0.5
+		}
+		return int(float64(limit) * backoff)
+	}
+	if sample.RTT <= 0 {
+		return limit
+	}
+	g.observe(float64(sample.RTT))
+
+	tolerance := g.Tolerance
+	if tolerance < 1 {
+		tolerance = 1.5
+	}
+	queueSize := g.QueueSize
+	if queueSize <= 0 {
+		queueSize = 4
+	}
+	smoothing := g.Smoothing
+	if smoothing <= 0 || smoothing > 1 {
+		smoothing = 0.2
+	}
+
+	gradient := tolerance * g.baseline / float64(sample.RTT)
+	gradient = math.Max(0.5, math.Min(1, gradient))
+
+	estimate := float64(limit)*gradient + float64(queueSize)
+	if sample.InFlight*2 < limit && estimate > float64(limit) {
+		// Do not grow a limit that is not being used.
+		return limit
+	}
+	return int(math.Round(float64(limit)*(1-smoothing) + estimate*smoothing))
+}
+
+// observe folds an RTT into the baseline: a plain average until the window
+// is full and an exponential moving average over the window afterwards.
+func (g *Gradient) observe(rtt float64) {
+	window := g.Window
+	if window <= 0 {
+		window = 600
+	}
+	if g.samples < window {
+		g.samples++
+	}
+	g.baseline += (rtt - g.baseline) / float64(g.samples)
+
+	// Let the baseline follow a lasting latency drop quickly, as the
+	// average would otherwise keep the limit high for a whole window.
+	if g.baseline > 2*rtt {
+		g.baseline *= 0.95
+	}
+}
+
+// AdaptiveOptions configures an AdaptiveLimiter. Zero values select the
+// defaults documented on each field.
+type AdaptiveOptions struct {
+	// Algorithm computes the limit. Defaults to &AIMD{}.
+	Algorithm LimitAlgorithm
+
+	// InitialLimit is the limit before any sample. Defaults to 10.
+	InitialLimit int
+
+	// MinLimit and MaxLimit bound the limit. They default to 1 and 1000.
+	MinLimit int
+	MaxLimit int
+
+	// MaxQueue and MaxWait bound waiting requests as in ConcurrencyOptions.
+	MaxQueue int
+	MaxWait  time.Duration
+
+	// IsDropped classifies a round trip as an overload signal. Defaults to
+	// DefaultIsDropped.
+	IsDropped func(resp *http.Response, err error) bool
+
+	// OnLimitChange, when set, is called with the new limit after each change.
+	OnLimitChange func(limit int)
+}
+
+// DefaultIsDropped reports timeouts and 429 and 503 responses as drops.
+func DefaultIsDropped(resp *http.Response, err error) bool {
+	if err != nil {
+		var netErr net.Error
+		return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+}
+
+// cancelledByCaller reports whether a round trip was cancelled by its
+// caller. Such outcomes say nothing about the upstream, so the adaptive
+// limiter and the circuit breaker ignore them.
+func cancelledByCaller(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
+
+// AdaptiveLimiter limits concurrent requests like ConcurrencyLimiter, but
+// adjusts its limit after every request using a LimitAlgorithm.
+type AdaptiveLimiter struct {
+	opts AdaptiveOptions
+	sem  *semaphore
+	mu   sync.Mutex
+}
+
+// NewAdaptiveLimiter creates an AdaptiveLimiter with the given options.
+func NewAdaptiveLimiter(opts AdaptiveOptions) *AdaptiveLimiter {
+	if opts.Algorithm == nil {
+		opts.Algorithm = &AIMD{}
+	}
+	if opts.MinLimit <= 0 {
+		opts.MinLimit = 1
+	}
+	if opts.MaxLimit <= 0 {
+		opts.MaxLimit = 1000
+	}
+	if opts.MaxLimit < opts.MinLimit {
+		opts.MaxLimit = opts.MinLimit
+	}
+	if opts.InitialLimit <= 0 {
+		opts.InitialLimit = 10
+	}
+	if opts.IsDropped == nil {
+		opts.IsDropped = DefaultIsDropped
+	}
+	limit := min(max(opts.InitialLimit, opts.MinLimit), opts.MaxLimit)
+	return &AdaptiveLimiter{opts: opts, sem: &semaphore{limit: limit}}
+}
+
+// Middleware returns a Middleware that acquires a slot for each round trip
+// and feeds its outcome to the limit algorithm.
+func (l *AdaptiveLimiter) Middleware() func(http.RoundTripper) http.RoundTripper {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return &adaptiveRoundTripper{next: next, limiter: l}
+	}
+}
+
+// Limit returns the current concurrency limit.
+func (l *AdaptiveLimiter) Limit() int {
+	return l.sem.stats().Limit
+}
+
+// Stats returns the current state of the limiter.
+func (l *AdaptiveLimiter) Stats() LimiterStats {
+	return l.sem.stats()
+}
+
+func (l *AdaptiveLimiter) observe(sample LimitSample) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	current := l.Limit()
+	limit := l.opts.Algorithm.Update(current, sample)
+	limit = min(max(limit, l.opts.MinLimit), l.opts.MaxLimit)
+	if limit == current {
+		return
+	}
+	l.sem.setLimit(limit)
+	if l.opts.OnLimitChange != nil {
+		l.opts.OnLimitChange(limit)
+	}
+}
+
+type adaptiveRoundTripper struct {
+	next    http.RoundTripper
+	limiter *AdaptiveLimiter
+}
+
+func (a *adaptiveRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	l := a.limiter
+	if err := l.sem.acquire(req.Context(), l.opts.MaxQueue, l.opts.MaxWait); err != nil {
+		return nil, err
+	}
+	inFlight := l.sem.stats().InFlight
+
+	start := time.Now()
+	resp, err := a.next.RoundTrip(req)
+	rtt := time.Since(start)
+	l.sem.release()
+
+	if !cancelledByCaller(err) {
+		l.observe(LimitSample{RTT: rtt, InFlight: inFlight, Dropped: l.opts.IsDropped(resp, err)})
+	}
+	return resp, err
+}
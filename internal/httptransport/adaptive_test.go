@@ -0,0 +1,109 @@
+package httptransport_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nativebpm/httpstream/internal/httptransport"
+)
+
+func TestAIMD_Update(t *testing.T) {
+	aimd := &httptransport.AIMD{}
+
+	if got := aimd.Update(10, httptransport.LimitSample{InFlight: 10}); got != 11 {
+		t.Errorf("expected additive increase to 11, got %d", got)
+	}
+	if got := aimd.Update(10, httptransport.LimitSample{InFlight: 2}); got != 10 {
+		t.Errorf("expected unused limit to stay at 10, got %d", got)
+	}
+	if got := aimd.Update(10, httptransport.LimitSample{InFlight: 10, Dropped: true}); got != 9 {
+		t.Errorf("expected multiplicative decrease to 9, got %d", got)
+	}
+}
+
+func TestGradient_Update(t *testing.T) {
+	gradient := &httptransport.Gradient{}
+
+	limit := 20
+	for i := 0; i < 10; i++ {
+		limit = gradient.Update(limit, httptransport.LimitSample{RTT: 10 * time.Millisecond, InFlight: limit})
+	}
+	if limit <= 20 {
+		t.Errorf("expected limit to grow while latency is flat, got %d", limit)
+	}
+
+	grown := limit
+	for i := 0; i < 10; i++ {
+		limit = gradient.Update(limit, httptransport.LimitSample{RTT: 100 * time.Millisecond, InFlight: limit})
+	}
+	if limit >= grown {
+		t.Errorf("expected limit to shrink when latency rises, got %d (was %d)", limit, grown)
+	}
+}
+
+func TestAdaptiveLimiter_ShrinksOnOverload(t *testing.T) {
+	var overloaded atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if overloaded.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var reported []int
+	limiter := httptransport.NewAdaptiveLimiter(httptransport.AdaptiveOptions{
+		Algorithm:     &httptransport.AIMD{Backoff: 0.5},
+		InitialLimit:  1,
+		MaxLimit:      8,
+		OnLimitChange: func(limit int) { reported = append(reported, limit) },
+	})
+	client := &http.Client{Transport: limiter.Middleware()(http.DefaultTransport)}
+
+	send := func() {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	for i := 0; i < 3; i++ {
+		send()
+	}
+	// Sequential requests use one slot, so growth stops once that is less
+	// than half of the limit.
+	if limiter.Limit() != 3 {
+		t.Errorf("expected limit to grow to 3, got %d", limiter.Limit())
+	}
+
+	overloaded.Store(true)
+	send()
+	if limiter.Limit() != 1 {
+		t.Errorf("expected limit to halve to 1, got %d", limiter.Limit())
+	}
+	if len(reported) != 3 || reported[0] != 2 || reported[1] != 3 || reported[2] != 1 {
+		t.Errorf("unexpected limit changes: %v", reported)
+	}
+}
+
+func TestGradient_AdaptsToLatencyShift(t *testing.T) {
+	gradient := &httptransport.Gradient{}
+
+	limit := gradient.Update(20, httptransport.LimitSample{RTT: 10 * time.Millisecond, InFlight: 20})
+	for i := 0; i < 20; i++ {
+		limit = gradient.Update(limit, httptransport.LimitSample{RTT: 40 * time.Millisecond, InFlight: limit})
+	}
+	shifted := limit
+
+	for i := 0; i < 480; i++ {
+		limit = gradient.Update(limit, httptransport.LimitSample{RTT: 40 * time.Millisecond, InFlight: limit})
+	}
+	if limit <= shifted || limit <= 20 {
+		t.Errorf("expected limit to recover once latency stabilized, got %d (was %d after the shift)", limit, shifted)
+	}
+}
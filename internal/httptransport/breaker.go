@@ -0,0 +1,336 @@
+package httptransport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned, without sending the request, while the
+// circuit of the request's key is open or has no half-open probe available.
+var ErrCircuitOpen = errors.New("httpstream: circuit breaker is open")
+
+// CircuitState is the state of a circuit.
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitBreakerOptions configures a CircuitBreaker. Zero values select the
+// defaults documented on each field.
+type CircuitBreakerOptions struct {
+	// Key partitions requests into independent circuits. Defaults to ByHost.
+	// Keys should have a bounded cardinality: circuits are created on demand
+	// and only closed circuits without outcomes in the window are swept.
+	Key func(req *http.Request) string
+
+	// IsFailure classifies the outcome of a round trip. Defaults to
+	// DefaultIsFailure.
+	IsFailure func(resp *http.Response, err error) bool
+
+	// Window is the rolling window over which outcomes are counted.
+	// Defaults to 10s.
+	Window time.Duration
+
+	// MinRequests is the number of requests a window must contain before
+	// the circuit can open. Defaults to 10.
+	MinRequests int
+
+	// FailureRatio is the share of failed requests in the window that opens
+	// the circuit. Defaults to 0.5.
+	FailureRatio float64
+
+	// Cooldown is how long an open circuit rejects requests before letting
+	// probes through. Defaults to 5s.
+	Cooldown time.Duration
+
+	// HalfOpenProbes is the number of concurrent probes allowed while
+	// half-open. The circuit closes once that many probes succeed and
+	// reopens on the first failed probe. Defaults to 1.
+	HalfOpenProbes int
+
+	// OnStateChange, when set, is called after a circuit changes state.
+	OnStateChange func(key string, from, to CircuitState)
+}
+
+// DefaultIsFailure reports transport errors, timeouts and 5xx responses as
+// failures. Requests cancelled by the caller are not failures.
+func DefaultIsFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return !cancelledByCaller(err)
+	}
+	return resp.StatusCode >= http.StatusInternalServerError
+}
+
+// LogCircuitStateChanges returns an OnStateChange callback that logs state
+// changes with the provided *slog.Logger, at warning level when a circuit
+// opens and at info level otherwise.
+func LogCircuitStateChanges(logger *slog.Logger) func(key string, from, to CircuitState) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return func(key string, from, to CircuitState) {
+		level := slog.LevelInfo
+		if to == CircuitOpen {
+			level = slog.LevelWarn
+		}
+		logger.Log(context.Background(), level, "Circuit breaker state changed",
+			"key", key,
+			"from", from.String(),
+			"to", to.String(),
+		)
+	}
+}
+
+// CircuitBreaker stops sending requests to upstreams that keep failing.
+// Each key has its own circuit, created on first use.
+type CircuitBreaker struct {
+	opts CircuitBreakerOptions
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+	sweepAt  int
+}
+
+// NewCircuitBreaker creates a CircuitBreaker with the given options.
+func NewCircuitBreaker(opts CircuitBreakerOptions) *CircuitBreaker {
+	if opts.Key == nil {
+		opts.Key = ByHost
+	}
+	if opts.IsFailure == nil {
+		opts.IsFailure = DefaultIsFailure
+	}
+	if opts.Window <= 0 {
+		opts.Window = 10 * time.Second
+	}
+	if opts.MinRequests <= 0 {
+		opts.MinRequests = 10
+	}
+	if opts.FailureRatio <= 0 || opts.FailureRatio > 1 {
+		opts.FailureRatio = 0.5
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = 5 * time.Second
+	}
+	if opts.HalfOpenProbes <= 0 {
+		opts.HalfOpenProbes = 1
+	}
+	return &CircuitBreaker{opts: opts, circuits: make(map[string]*circuit), sweepAt: minSweep}
+}
+
+// Middleware returns a Middleware that routes each request through the
+// circuit of its key.
+func (b *CircuitBreaker) Middleware() func(http.RoundTripper) http.RoundTripper {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return &breakerRoundTripper{next: next, breaker: b}
+	}
+}
+
+// State returns the state of the circuit of key.
+func (b *CircuitBreaker) State(key string) CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.circuits[key]
+	if !ok {
+		return CircuitClosed
+	}
+	if c.state == CircuitOpen && time.Since(c.openedAt) >= b.opts.Cooldown {
+		return CircuitHalfOpen
+	}
+	return c.state
+}
+
+// allow reports whether a request for key may be sent and whether it is a
+// half-open probe.
+func (b *CircuitBreaker) allow(key string, now time.Time) (probe bool, err error) {
+	b.mu.Lock()
+	c := b.circuit(key, now)
+	from := c.state
+	if c.state == CircuitOpen && now.Sub(c.openedAt) >= b.opts.Cooldown {
+		c.state, c.probes, c.successes = CircuitHalfOpen, 0, 0
+	}
+	switch {
+	case c.state == CircuitHalfOpen && c.probes < b.opts.HalfOpenProbes:
+		c.probes++
+		probe = true
+	case c.state != CircuitClosed:
+		err = fmt.Errorf("%w: %s", ErrCircuitOpen, key)
+	}
+	to := c.state
+	b.mu.Unlock()
+
+	b.notify(key, from, to)
+	return probe, err
+}
+
+// outcome classifies a completed request for its circuit.
+type outcome int
+
+const (
+	outcomeIgnored outcome = iota
+	outcomeSuccess
+	outcomeFailure
+)
+
+// record feeds the outcome of a request into its circuit.
+func (b *CircuitBreaker) record(key string, probe bool, result outcome, now time.Time) {
+	b.mu.Lock()
+	c := b.circuit(key, now)
+	from := c.state
+	switch {
+	case probe && c.state == CircuitHalfOpen:
+		c.probes--
+		switch result {
+		case outcomeFailure:
+			c.state, c.openedAt = CircuitOpen, now
+		case outcomeSuccess:
+			c.successes++
+			if c.successes >= b.opts.HalfOpenProbes {
+				c.state, c.window = CircuitClosed, [circuitBuckets]circuitBucket{}
+			}
+		}
+	case !probe && c.state == CircuitClosed && result != outcomeIgnored:
+		total, failures := c.add(result == outcomeFailure, now, b.opts.Window)
+		if total >= b.opts.MinRequests && float64(failures) >= b.opts.FailureRatio*float64(total) {
+			c.state, c.openedAt = CircuitOpen, now
+		}
+	}
+	to := c.state
+	b.mu.Unlock()
+
+	b.notify(key, from, to)
+}
+
+// circuit returns the circuit of key, creating it if needed. b.mu must be
+// held.
+func (b *CircuitBreaker) circuit(key string, now time.Time) *circuit {
+	c, ok := b.circuits[key]
+	if !ok {
+		if len(b.circuits) >= b.sweepAt {
+			b.sweep(now)
+		}
+		c = &circuit{}
+		b.circuits[key] = c
+	}
+	return c
+}
+
+// sweep removes closed circuits without outcomes in the window, which
+// behave like circuits that were never created. b.mu must be held.
+func (b *CircuitBreaker) sweep(now time.Time) {
+	for key, c := range b.circuits {
+		if c.state == CircuitClosed && c.idle(now, b.opts.Window) {
+			delete(b.circuits, key)
+		}
+	}
+	b.sweepAt = max(2*len(b.circuits), minSweep)
+}
+
+func (b *CircuitBreaker) notify(key string, from, to CircuitState) {
+	if from != to && b.opts.OnStateChange != nil {
+		b.opts.OnStateChange(key, from, to)
+	}
+}
+
+const circuitBuckets = 10
+
+type circuitBucket struct {
+	start    int64
+	total    int
+	failures int
+}
+
+type circuit struct {
+	state     CircuitState
+	openedAt  time.Time
+	probes    int
+	successes int
+	window    [circuitBuckets]circuitBucket
+}
+
+// slot returns the index of the window bucket of now.
+func slot(now time.Time, window time.Duration) int64 {
+	width := int64(window / circuitBuckets)
+	if width <= 0 {
+		width = 1
+	}
+	return now.UnixNano() / width
+}
+
+// idle reports whether no outcome was counted inside the window.
+func (c *circuit) idle(now time.Time, window time.Duration) bool {
+	slot := slot(now, window)
+	for _, bucket := range c.window {
+		if bucket.total > 0 && slot-bucket.start < circuitBuckets {
+			return false
+		}
+	}
+	return true
+}
+
+// add counts an outcome in the rolling window and returns the totals of the
+// buckets that are still inside it.
+func (c *circuit) add(failed bool, now time.Time, window time.Duration) (total, failures int) {
+	slot := slot(now, window)
+
+	bucket := &c.window[slot%circuitBuckets]
+	if bucket.start != slot {
+		*bucket = circuitBucket{start: slot}
+	}
+	bucket.total++
+	if failed {
+		bucket.failures++
+	}
+
+	for _, bucket := range c.window {
+		if slot-bucket.start < circuitBuckets {
+			total += bucket.total
+			failures += bucket.failures
+		}
+	}
+	return total, failures
+}
+
+type breakerRoundTripper struct {
+	next    http.RoundTripper
+	breaker *CircuitBreaker
+}
+
+func (b *breakerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := b.breaker.opts.Key(req)
+	probe, err := b.breaker.allow(key, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := b.next.RoundTrip(req)
+
+	result := outcomeSuccess
+	switch {
+	case cancelledByCaller(err):
+		result = outcomeIgnored
+	case b.breaker.opts.IsFailure(resp, err):
+		result = outcomeFailure
+	}
+	b.breaker.record(key, probe, result, time.Now())
+	return resp, err
+}
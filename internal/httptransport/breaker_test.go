@@ -0,0 +1,153 @@
+package httptransport_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nativebpm/httpstream/internal/httptransport"
+)
+
+func TestCircuitBreaker_OpensAndRecovers(t *testing.T) {
+	var calls atomic.Int32
+	var healthy atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var transitions []string
+	breaker := httptransport.NewCircuitBreaker(httptransport.CircuitBreakerOptions{
+		MinRequests: 3,
+		Cooldown:    50 * time.Millisecond,
+		OnStateChange: func(_ string, from, to httptransport.CircuitState) {
+			transitions = append(transitions, from.String()+"->"+to.String())
+		},
+	})
+	client := &http.Client{Transport: breaker.Middleware()(http.DefaultTransport)}
+	host := mustHost(t, server.URL)
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+	if state := breaker.State(host); state != httptransport.CircuitOpen {
+		t.Fatalf("expected open circuit, got %v", state)
+	}
+
+	_, err := client.Get(server.URL)
+	if !errors.Is(err, httptransport.ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen, got %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("expected open circuit not to reach the server, got %d calls", calls.Load())
+	}
+
+	healthy.Store(true)
+	time.Sleep(60 * time.Millisecond)
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("expected probe to be sent, got %v", err)
+	}
+	resp.Body.Close()
+
+	if state := breaker.State(host); state != httptransport.CircuitClosed {
+		t.Errorf("expected closed circuit after successful probe, got %v", state)
+	}
+	want := []string{"closed->open", "open->half-open", "half-open->closed"}
+	if len(transitions) != len(want) {
+		t.Fatalf("expected transitions %v, got %v", want, transitions)
+	}
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Errorf("expected transitions %v, got %v", want, transitions)
+			break
+		}
+	}
+}
+
+func TestCircuitBreaker_FailedProbeReopens(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	breaker := httptransport.NewCircuitBreaker(httptransport.CircuitBreakerOptions{
+		MinRequests: 1,
+		Cooldown:    20 * time.Millisecond,
+	})
+	client := &http.Client{Transport: breaker.Middleware()(http.DefaultTransport)}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	time.Sleep(30 * time.Millisecond)
+	resp, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("expected probe to be sent, got %v", err)
+	}
+	resp.Body.Close()
+
+	if state := breaker.State(mustHost(t, server.URL)); state != httptransport.CircuitOpen {
+		t.Errorf("expected circuit to reopen after failed probe, got %v", state)
+	}
+}
+
+func mustHost(t *testing.T, rawURL string) string {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("url.Parse: %v", err)
+	}
+	return u.Host
+}
+
+func TestCircuitBreaker_SweepKeepsOpenCircuits(t *testing.T) {
+	breaker := httptransport.NewCircuitBreaker(httptransport.CircuitBreakerOptions{
+		Key:         func(req *http.Request) string { return req.Header.Get("X-Tenant") },
+		MinRequests: 1,
+		Window:      time.Millisecond,
+	})
+	rt := breaker.Middleware()(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		status := http.StatusOK
+		if req.Header.Get("X-Tenant") == "bad" {
+			status = http.StatusInternalServerError
+		}
+		return &http.Response{StatusCode: status, Body: http.NoBody}, nil
+	}))
+
+	send := func(tenant string) {
+		req := mustRequest(t, context.Background())
+		req.Header.Set("X-Tenant", tenant)
+		if _, err := rt.RoundTrip(req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	send("bad")
+	time.Sleep(2 * time.Millisecond)
+	for i := 0; i < 500; i++ {
+		send(strconv.Itoa(i))
+	}
+
+	if state := breaker.State("bad"); state != httptransport.CircuitOpen {
+		t.Errorf("expected open circuit to survive sweeping, got %v", state)
+	}
+}
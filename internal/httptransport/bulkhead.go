@@ -0,0 +1,163 @@
+package httptransport
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+type routeKey struct{}
+
+// WithRoute returns a copy of ctx carrying the unexpanded route template of
+// a request, such as "/users/{id}".
+func WithRoute(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, routeKey{}, route)
+}
+
+// Route returns the route template stored in ctx by WithRoute.
+func Route(ctx context.Context) (string, bool) {
+	route, ok := ctx.Value(routeKey{}).(string)
+	return route, ok
+}
+
+// ByHost partitions requests by target host.
+func ByHost(req *http.Request) string {
+	return req.URL.Host
+}
+
+// ByRoute partitions requests by method and route template, so that
+// "/users/1" and "/users/2" share the compartment of "GET /users/{id}".
+// Requests without a route template fall back to their URL path.
+func ByRoute(req *http.Request) string {
+	route, ok := Route(req.Context())
+	if !ok {
+		route = req.URL.Path
+	}
+	return req.Method + " " + route
+}
+
+// BulkheadOptions configures a Bulkhead.
+type BulkheadOptions struct {
+	// Key partitions requests into compartments. Defaults to ByHost. Keys
+	// missing from Limits should still have a bounded cardinality: their
+	// compartments are created on demand and swept once idle, which resets
+	// their statistics.
+	Key func(req *http.Request) string
+
+	// Limits configures the compartments of specific keys.
+	Limits map[string]ConcurrencyOptions
+
+	// Default configures compartments of keys missing from Limits. When
+	// Default.Limit <= 0, such requests are not limited.
+	Default ConcurrencyOptions
+}
+
+// Bulkhead isolates requests into compartments, each with its own
+// ConcurrencyLimiter, so that one slow upstream cannot take the slots of the
+// others. Compartments are created on first use; those of keys without a
+// limit are never created.
+type Bulkhead struct {
+	opts BulkheadOptions
+
+	mu           sync.Mutex
+	compartments map[string]*compartment
+	sweepAt      int
+}
+
+// compartment is the limiter of one key and the number of round trips using
+// it.
+type compartment struct {
+	limiter    *ConcurrencyLimiter
+	configured bool
+	refs       int
+}
+
+// minSweep is the number of keyed entries, such as bulkhead compartments
+// and circuits, below which idle ones are not swept.
+const minSweep = 64
+
+// NewBulkhead creates a Bulkhead with the given options.
+func NewBulkhead(opts BulkheadOptions) *Bulkhead {
+	if opts.Key == nil {
+		opts.Key = ByHost
+	}
+	return &Bulkhead{opts: opts, compartments: make(map[string]*compartment), sweepAt: minSweep}
+}
+
+// Middleware returns a Middleware that acquires a slot from the compartment
+// of each request for the duration of its round trip.
+func (b *Bulkhead) Middleware() func(http.RoundTripper) http.RoundTripper {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return &bulkheadRoundTripper{next: next, bulkhead: b}
+	}
+}
+
+// Stats returns the current state of every compartment, keyed by key.
+func (b *Bulkhead) Stats() map[string]LimiterStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := make(map[string]LimiterStats, len(b.compartments))
+	for key, c := range b.compartments {
+		stats[key] = c.limiter.Stats()
+	}
+	return stats
+}
+
+// acquire returns the compartment of key, or nil when its requests are not
+// limited. The compartment cannot be swept until it is passed to done.
+func (b *Bulkhead) acquire(key string) *compartment {
+	opts, configured := b.opts.Limits[key]
+	if !configured {
+		opts = b.opts.Default
+	}
+	if opts.Limit <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.compartments[key]
+	if !ok {
+		if len(b.compartments) >= b.sweepAt {
+			b.sweep()
+		}
+		c = &compartment{limiter: NewConcurrencyLimiter(opts), configured: configured}
+		b.compartments[key] = c
+	}
+	c.refs++
+	return c
+}
+
+func (b *Bulkhead) done(c *compartment) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c.refs--
+}
+
+// sweep removes the idle compartments of keys missing from Limits. A slot
+// held by a response body keeps its compartment. b.mu must be held.
+func (b *Bulkhead) sweep() {
+	for key, c := range b.compartments {
+		if c.configured || c.refs > 0 {
+			continue
+		}
+		if stats := c.limiter.Stats(); stats.InFlight == 0 && stats.Queued == 0 {
+			delete(b.compartments, key)
+		}
+	}
+	b.sweepAt = max(2*len(b.compartments), minSweep)
+}
+
+type bulkheadRoundTripper struct {
+	next     http.RoundTripper
+	bulkhead *Bulkhead
+}
+
+func (b *bulkheadRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	c := b.bulkhead.acquire(b.bulkhead.opts.Key(req))
+	if c == nil {
+		return b.next.RoundTrip(req)
+	}
+	defer b.bulkhead.done(c)
+	return c.limiter.roundTrip(b.next, req)
+}
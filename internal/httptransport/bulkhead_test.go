@@ -0,0 +1,109 @@
+package httptransport_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/nativebpm/httpstream"
+	"github.com/nativebpm/httpstream/internal/httprequest"
+	"github.com/nativebpm/httpstream/internal/httptransport"
+)
+
+func TestBulkhead_ByRouteIsolatesCompartments(t *testing.T) {
+	slow := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow/1" {
+			<-slow
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	bulkhead := httptransport.NewBulkhead(httptransport.BulkheadOptions{
+		Key: httptransport.ByRoute,
+		Limits: map[string]httptransport.ConcurrencyOptions{
+			"GET /slow/{id}": {Limit: 1, MaxQueue: -1},
+		},
+		Default: httptransport.ConcurrencyOptions{Limit: 4},
+	})
+
+	client, err := httpstream.NewClient(&http.Client{}, server.URL)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	client.Use(bulkhead.Middleware())
+
+	done := make(chan error, 1)
+	go func() {
+		resp, err := client.GET(context.Background(), "/slow/{id}").PathInt("id", 1).Send()
+		if err == nil {
+			resp.Body.Close()
+		}
+		done <- err
+	}()
+	waitFor(t, func() bool { return bulkhead.Stats()["GET /slow/{id}"].InFlight == 1 })
+
+	_, err = client.GET(context.Background(), "/slow/{id}").PathInt("id", 2).Send()
+	if !errors.Is(err, httptransport.ErrLimiterQueueFull) {
+		t.Errorf("expected ErrLimiterQueueFull for the saturated route, got %v", err)
+	}
+
+	resp, err := client.GET(context.Background(), "/fast").Send()
+	if err != nil {
+		t.Fatalf("expected other route to proceed, got %v", err)
+	}
+	resp.Body.Close()
+
+	close(slow)
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	stats := bulkhead.Stats()
+	if stats["GET /slow/{id}"].Rejected != 1 || stats["GET /fast"].Limit != 4 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestByHost(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "http://api.example.com:8080/users", nil)
+	if key := httptransport.ByHost(req); key != "api.example.com:8080" {
+		t.Errorf("expected host key, got %q", key)
+	}
+}
+
+func TestBulkhead_BoundsCompartments(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	limited := httptransport.NewBulkhead(httptransport.BulkheadOptions{
+		Key:     httptransport.ByRoute,
+		Default: httptransport.ConcurrencyOptions{Limit: 2},
+	})
+	unlimited := httptransport.NewBulkhead(httptransport.BulkheadOptions{Key: httptransport.ByRoute})
+
+	for i := 0; i < 1000; i++ {
+		// Requests built without Client.Request have no route template.
+		resp, err := httprequest.NewRequest(context.Background(), http.Client{}, http.MethodGet, server.URL+"/users/"+strconv.Itoa(i)).
+			Use(limited.Middleware()).
+			Use(unlimited.Middleware()).
+			Send()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	if n := len(limited.Stats()); n > 128 {
+		t.Errorf("expected idle compartments to be swept, got %d", n)
+	}
+	if n := len(unlimited.Stats()); n != 0 {
+		t.Errorf("expected no compartments for unlimited keys, got %d", n)
+	}
+}
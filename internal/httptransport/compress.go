@@ -0,0 +1,79 @@
+package httptransport
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/nativebpm/httpstream/internal/httpcompress"
+)
+
+// CompressionOptions configures CompressionMiddleware. Zero values select
+// the defaults documented on each field.
+type CompressionOptions struct {
+	// Encoding is the content coding. Defaults to "gzip". "deflate" is also
+	// built in; other codings need NewWriter.
+	Encoding string
+
+	// Level is the compression level of the built-in codings (see
+	// compress/gzip). Defaults to gzip.DefaultCompression.
+	Level int
+
+	// NewWriter, when set, wraps the body writer in the encoder of Encoding.
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+}
+
+// CompressionMiddleware returns a Middleware that compresses request bodies
+// on the fly: each body is streamed through the encoder in a goroutine, so
+// memory use stays bounded whatever the body size. Content-Encoding is set
+// and Content-Length dropped. Requests without a body or that already have
+// a Content-Encoding are sent unchanged, and GetBody is wrapped so retries
+// and redirects re-send a compressed body. An unsupported Encoding fails
+// every request with ErrUnsupportedEncoding.
+func CompressionMiddleware(opts CompressionOptions) func(http.RoundTripper) http.RoundTripper {
+	if opts.Encoding == "" {
+		opts.Encoding = "gzip"
+	}
+
+	var compress httpcompress.Compressor = opts.NewWriter
+	var err error
+	if compress == nil {
+		compress, err = httpcompress.NewCompressor(opts.Encoding, opts.Level)
+	}
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return &compressingRoundTripper{next: next, encoding: opts.Encoding, compress: compress, err: err}
+	}
+}
+
+type compressingRoundTripper struct {
+	next     http.RoundTripper
+	encoding string
+	compress httpcompress.Compressor
+	err      error
+}
+
+func (c *compressingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.Body == http.NoBody || req.Header.Get("Content-Encoding") != "" {
+		return c.next.RoundTrip(req)
+	}
+	if c.err != nil {
+		req.Body.Close()
+		return nil, c.err
+	}
+
+	out := req.Clone(req.Context())
+	out.Body = httpcompress.Reader(req.Body, c.compress)
+	out.ContentLength = -1
+	out.Header.Set("Content-Encoding", c.encoding)
+	out.Header.Del("Content-Length")
+	if getBody := req.GetBody; getBody != nil {
+		out.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return httpcompress.Reader(body, c.compress), nil
+		}
+	}
+	return c.next.RoundTrip(out)
+}
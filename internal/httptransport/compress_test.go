@@ -0,0 +1,79 @@
+package httptransport_test
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nativebpm/httpstream/internal/httprequest"
+	"github.com/nativebpm/httpstream/internal/httptransport"
+)
+
+func TestCompressionMiddleware_CompressesEveryAttempt(t *testing.T) {
+	payload := strings.Repeat("line of log output\n", 500)
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("expected Content-Encoding gzip, got %q", r.Header.Get("Content-Encoding"))
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("gzip.NewReader: %v", err)
+			return
+		}
+		if body, _ := io.ReadAll(zr); string(body) != payload {
+			t.Errorf("unexpected decompressed body of %d bytes", len(body))
+		}
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	resp, err := httprequest.NewRequest(context.Background(), http.Client{}, http.MethodPost, server.URL).
+		Use(httptransport.CompressionMiddleware(httptransport.CompressionOptions{})).
+		Use(httptransport.RetryMiddleware(httptransport.RetryOptions{BaseDelay: time.Millisecond})).
+		Body(io.NopCloser(strings.NewReader(payload)), "text/plain").
+		Spool(1<<20, "").
+		Send()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || calls.Load() != 2 {
+		t.Errorf("expected success on the second attempt, got %d after %d calls", resp.StatusCode, calls.Load())
+	}
+}
+
+func TestCompressionMiddleware_SkipsEncodedBodies(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = r.Header.Get("Content-Encoding") + ":" + string(data)
+	}))
+	defer server.Close()
+
+	resp, err := httprequest.NewRequest(context.Background(), http.Client{}, http.MethodPost, server.URL).
+		Use(httptransport.CompressionMiddleware(httptransport.CompressionOptions{Encoding: "deflate"})).
+		Header("Content-Encoding", "identity").
+		Body(io.NopCloser(strings.NewReader("raw")), "text/plain").
+		Send()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if body != "identity:raw" {
+		t.Errorf("expected body to be sent unchanged, got %q", body)
+	}
+}
@@ -0,0 +1,214 @@
+package httptransport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/nativebpm/httpstream/internal/httpcompress"
+)
+
+// ErrDecompressionLimit is returned by reads of a decompressed response body
+// that exceeds DecompressionOptions.MaxSize or MaxRatio.
+var ErrDecompressionLimit = errors.New("httpstream: decompressed response exceeds limit")
+
+// DecompressionOptions configures DecompressionMiddleware. Zero values
+// select the defaults documented on each field.
+type DecompressionOptions struct {
+	// Decoders adds content codings, such as "br" or "zstd", to the built-in
+	// "gzip" and "deflate", or replaces them. Keys are case-insensitive.
+	Decoders map[string]func(r io.Reader) (io.ReadCloser, error)
+
+	// MaxSize is the largest decompressed body allowed, in bytes. Zero means
+	// no limit.
+	MaxSize int64
+
+	// MaxRatio is the largest allowed ratio of decompressed to compressed
+	// bytes. Defaults to 100; a negative value disables the check.
+	MaxRatio float64
+
+	// RatioThreshold is the number of decompressed bytes before MaxRatio is
+	// enforced, so small, highly compressible bodies are not rejected.
+	// Defaults to 1 MiB.
+	RatioThreshold int64
+}
+
+// DecompressionMiddleware returns a Middleware that advertises the supported
+// content codings in Accept-Encoding, unless the request sets it, and
+// replaces the body of encoded responses with a streaming decoder.
+// Content-Encoding and Content-Length are removed from decoded responses and
+// Uncompressed is set. Responses in codings without a decoder are returned
+// unchanged. Reads fail with ErrDecompressionLimit once the decoded body
+// grows past MaxSize or MaxRatio, guarding against decompression bombs.
+func DecompressionMiddleware(opts DecompressionOptions) func(http.RoundTripper) http.RoundTripper {
+	if opts.MaxRatio == 0 {
+		opts.MaxRatio = 100
+	}
+	if opts.RatioThreshold <= 0 {
+		opts.RatioThreshold = 1 << 20
+	}
+
+	decoders := make(map[string]httpcompress.Decompressor)
+	for _, encoding := range []string{"gzip", "x-gzip", "deflate"} {
+		decoders[encoding], _ = httpcompress.NewDecompressor(encoding)
+	}
+	for encoding, decoder := range opts.Decoders {
+		decoders[strings.ToLower(encoding)] = decoder
+	}
+
+	encodings := make([]string, 0, len(decoders))
+	for encoding := range decoders {
+		if encoding != "x-gzip" {
+			encodings = append(encodings, encoding)
+		}
+	}
+	sort.Strings(encodings)
+	accept := strings.Join(encodings, ", ")
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return &decompressingRoundTripper{next: next, opts: opts, decoders: decoders, accept: accept}
+	}
+}
+
+type decompressingRoundTripper struct {
+	next     http.RoundTripper
+	opts     DecompressionOptions
+	decoders map[string]httpcompress.Decompressor
+	accept   string
+}
+
+func (d *decompressingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Accept-Encoding") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Accept-Encoding", d.accept)
+	}
+
+	resp, err := d.next.RoundTrip(req)
+	if err != nil || resp.Body == nil || resp.Body == http.NoBody {
+		return resp, err
+	}
+
+	// Codings are listed in the order they were applied.
+	var chain []httpcompress.Decompressor
+	for _, value := range resp.Header.Values("Content-Encoding") {
+		for _, encoding := range strings.Split(value, ",") {
+			encoding = strings.ToLower(strings.TrimSpace(encoding))
+			if encoding == "" || encoding == "identity" {
+				continue
+			}
+			decoder, ok := d.decoders[encoding]
+			if !ok {
+				return resp, nil
+			}
+			chain = append(chain, decoder)
+		}
+	}
+	if len(chain) == 0 {
+		return resp, nil
+	}
+
+	resp.Body = &decompressedBody{raw: &countingReader{r: resp.Body}, body: resp.Body, chain: chain, opts: d.opts}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// decompressedBody decodes a response body through a chain of decoders,
+// created on the first read so RoundTrip does not block on the body, and
+// enforces the size limits.
+type decompressedBody struct {
+	raw     *countingReader
+	body    io.Closer
+	chain   []httpcompress.Decompressor
+	opts    DecompressionOptions
+	decoder io.Reader
+	closers []io.Closer
+	n       int64
+	err     error
+}
+
+func (b *decompressedBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.decoder == nil {
+		if err := b.init(); err != nil {
+			b.err = err
+			return 0, err
+		}
+	}
+
+	if b.opts.MaxSize > 0 {
+		// Read at most one byte past the limit to detect it.
+		if rest := b.opts.MaxSize - b.n + 1; int64(len(p)) > rest {
+			p = p[:rest]
+		}
+	}
+	n, err := b.decoder.Read(p)
+	b.n += int64(n)
+	if limitErr := b.checkLimits(); limitErr != nil {
+		if over := b.n - b.opts.MaxSize; b.opts.MaxSize > 0 && over > 0 {
+			// Withhold the byte read only to detect the overflow.
+			n -= int(over)
+			b.n = b.opts.MaxSize
+		}
+		b.err = limitErr
+		return n, limitErr
+	}
+	if err != nil {
+		b.err = err
+	}
+	return n, err
+}
+
+func (b *decompressedBody) init() error {
+	var r io.Reader = b.raw
+	for i := len(b.chain) - 1; i >= 0; i-- {
+		rc, err := b.chain[i](r)
+		if err != nil {
+			if errors.Is(err, io.EOF) && b.raw.n == 0 {
+				// An empty body, as sent with some 204 and HEAD responses.
+				return io.EOF
+			}
+			return err
+		}
+		b.closers = append(b.closers, rc)
+		r = rc
+	}
+	b.decoder = r
+	return nil
+}
+
+func (b *decompressedBody) checkLimits() error {
+	if b.opts.MaxSize > 0 && b.n > b.opts.MaxSize {
+		return fmt.Errorf("%w: more than %d bytes", ErrDecompressionLimit, b.opts.MaxSize)
+	}
+	if b.opts.MaxRatio > 0 && b.n > b.opts.RatioThreshold && float64(b.n) > b.opts.MaxRatio*float64(b.raw.n) {
+		return fmt.Errorf("%w: %d bytes from %d compressed", ErrDecompressionLimit, b.n, b.raw.n)
+	}
+	return nil
+}
+
+func (b *decompressedBody) Close() error {
+	for i := len(b.closers) - 1; i >= 0; i-- {
+		b.closers[i].Close()
+	}
+	return b.body.Close()
+}
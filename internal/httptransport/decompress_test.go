@@ -0,0 +1,169 @@
+package httptransport_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nativebpm/httpstream/internal/httprequest"
+	"github.com/nativebpm/httpstream/internal/httptransport"
+)
+
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "zlib":
+		w = zlib.NewWriter(&buf)
+	case "flate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	case "base64":
+		w = base64.NewEncoder(base64.StdEncoding, &buf)
+	}
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func base64Decoder(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(base64.NewDecoder(base64.StdEncoding, r)), nil
+}
+
+func TestDecompressionMiddleware_DecodesResponses(t *testing.T) {
+	payload := []byte(strings.Repeat("hello, decompression\n", 100))
+
+	tests := []struct {
+		name            string
+		contentEncoding string
+		body            []byte
+	}{
+		{name: "gzip", contentEncoding: "gzip", body: compress(t, "gzip", payload)},
+		{name: "zlib deflate", contentEncoding: "deflate", body: compress(t, "zlib", payload)},
+		{name: "raw deflate", contentEncoding: "deflate", body: compress(t, "flate", payload)},
+		{name: "custom coding", contentEncoding: "base64", body: compress(t, "base64", payload)},
+		{name: "stacked codings", contentEncoding: "gzip, base64", body: compress(t, "base64", compress(t, "gzip", payload))},
+		{name: "identity", contentEncoding: "", body: payload},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var accept string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				accept = r.Header.Get("Accept-Encoding")
+				if tt.contentEncoding != "" {
+					w.Header().Set("Content-Encoding", tt.contentEncoding)
+				}
+				w.Write(tt.body)
+			}))
+			defer server.Close()
+
+			resp, err := httprequest.NewRequest(context.Background(), http.Client{}, http.MethodGet, server.URL).
+				Use(httptransport.DecompressionMiddleware(httptransport.DecompressionOptions{
+					Decoders: map[string]func(io.Reader) (io.ReadCloser, error){"base64": base64Decoder},
+				})).
+				Send()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("read body: %v", err)
+			}
+			if !bytes.Equal(body, payload) {
+				t.Errorf("unexpected body of %d bytes", len(body))
+			}
+			if accept != "base64, deflate, gzip" {
+				t.Errorf("unexpected Accept-Encoding %q", accept)
+			}
+			if resp.Header.Get("Content-Encoding") != "" || resp.Header.Get("Content-Length") != "" {
+				t.Errorf("expected stale headers to be removed, got %v", resp.Header)
+			}
+		})
+	}
+}
+
+func TestDecompressionMiddleware_Limits(t *testing.T) {
+	bomb := compress(t, "gzip", make([]byte, 8<<20))
+
+	tests := []struct {
+		name string
+		opts httptransport.DecompressionOptions
+		ok   bool
+	}{
+		{name: "max size", opts: httptransport.DecompressionOptions{MaxSize: 1 << 20, MaxRatio: -1}},
+		{name: "small max size", opts: httptransport.DecompressionOptions{MaxSize: 100, MaxRatio: -1}},
+		{name: "default ratio", opts: httptransport.DecompressionOptions{}},
+		{name: "disabled", opts: httptransport.DecompressionOptions{MaxRatio: -1}, ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Encoding", "gzip")
+				w.Write(bomb)
+			}))
+			defer server.Close()
+
+			resp, err := httprequest.NewRequest(context.Background(), http.Client{}, http.MethodGet, server.URL).
+				Use(httptransport.DecompressionMiddleware(tt.opts)).
+				Send()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer resp.Body.Close()
+
+			n, err := io.Copy(io.Discard, resp.Body)
+			if tt.ok {
+				if err != nil || n != 8<<20 {
+					t.Errorf("expected the whole body, got %d bytes, %v", n, err)
+				}
+				return
+			}
+			if !errors.Is(err, httptransport.ErrDecompressionLimit) {
+				t.Errorf("expected ErrDecompressionLimit, got %v after %d bytes", err, n)
+			}
+			if tt.opts.MaxSize > 0 && n != tt.opts.MaxSize {
+				t.Errorf("expected exactly %d bytes before the error, got %d", tt.opts.MaxSize, n)
+			}
+		})
+	}
+}
+
+func TestDecompressionMiddleware_UnknownCodingPassesThrough(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "br" {
+			t.Errorf("expected caller's Accept-Encoding to be kept, got %q", r.Header.Get("Accept-Encoding"))
+		}
+		w.Header().Set("Content-Encoding", "br")
+		w.Write([]byte("opaque"))
+	}))
+	defer server.Close()
+
+	resp, err := httprequest.NewRequest(context.Background(), http.Client{}, http.MethodGet, server.URL).
+		Use(httptransport.DecompressionMiddleware(httptransport.DecompressionOptions{})).
+		Header("Accept-Encoding", "br").
+		Send()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "opaque" || resp.Header.Get("Content-Encoding") != "br" {
+		t.Errorf("expected response to be unchanged, got %q with %v", body, resp.Header)
+	}
+}
@@ -1,32 +1,252 @@
 package httptransport
 
 import (
+	"container/list"
+	"context"
+	"errors"
+	"io"
 	"net/http"
+	"sync"
+	"time"
 )
 
+var (
+	// ErrLimiterQueueFull is returned when a request cannot be queued because
+	// the limiter's wait queue is full.
+	ErrLimiterQueueFull = errors.New("httpstream: concurrency limiter queue is full")
+
+	// ErrLimiterTimeout is returned when a request waited longer than the
+	// limiter's MaxWait for a free slot.
+	ErrLimiterTimeout = errors.New("httpstream: timed out waiting for a concurrency slot")
+)
+
+// ConcurrencyOptions configures a ConcurrencyLimiter.
+type ConcurrencyOptions struct {
+	// Limit is the maximum number of requests in flight. When Limit <= 0 the
+	// limiter is a no-op.
+	Limit int
+
+	// MaxQueue bounds the number of requests waiting for a slot. Requests
+	// beyond it fail fast with ErrLimiterQueueFull. Zero means unbounded and
+	// a negative value rejects every request that cannot start immediately.
+	MaxQueue int
+
+	// MaxWait bounds how long a request waits for a slot before failing with
+	// ErrLimiterTimeout. Zero means the wait is bounded only by the request
+	// context.
+	MaxWait time.Duration
+
+	// HoldUntilBodyClose keeps the slot until the response body is closed or
+	// read to EOF instead of releasing it once headers arrive, so the limit
+	// applies to bodies being streamed. The slot is also released when the
+	// request context is done.
+	HoldUntilBodyClose bool
+}
+
+// LimiterStats is a point-in-time snapshot of a limiter.
+type LimiterStats struct {
+	Limit    int
+	InFlight int
+	Queued   int
+	Rejected uint64
+}
+
+// ConcurrencyLimiter limits the number of concurrent HTTP requests in flight
+// across every RoundTripper produced by its Middleware. Waiting requests are
+// served in FIFO order and give up when their context is done.
+type ConcurrencyLimiter struct {
+	opts ConcurrencyOptions
+	sem  *semaphore
+}
+
+// NewConcurrencyLimiter creates a ConcurrencyLimiter with the given options.
+func NewConcurrencyLimiter(opts ConcurrencyOptions) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{opts: opts, sem: &semaphore{limit: opts.Limit}}
+}
+
+// Middleware returns a Middleware that acquires a slot from the limiter for
+// the duration of each round trip.
+func (l *ConcurrencyLimiter) Middleware() func(http.RoundTripper) http.RoundTripper {
+	if l.opts.Limit <= 0 {
+		return func(next http.RoundTripper) http.RoundTripper { return next }
+	}
+	return func(next http.RoundTripper) http.RoundTripper {
+		return &concurrencyLimiter{next: next, limiter: l}
+	}
+}
+
+// Stats returns the current state of the limiter.
+func (l *ConcurrencyLimiter) Stats() LimiterStats {
+	return l.sem.stats()
+}
+
 // ConcurrencyMiddleware returns a Middleware that limits the number of
-// concurrent HTTP requests in flight. It uses a buffered channel as a semaphore.
+// concurrent HTTP requests in flight.
 // When limit <= 0, the middleware is a no-op.
 func ConcurrencyMiddleware(limit int) func(http.RoundTripper) http.RoundTripper {
-	if limit <= 0 {
-		return func(next http.RoundTripper) http.RoundTripper { return next }
+	return NewConcurrencyLimiter(ConcurrencyOptions{Limit: limit}).Middleware()
+}
+
+type concurrencyLimiter struct {
+	next    http.RoundTripper
+	limiter *ConcurrencyLimiter
+}
+
+func (c *concurrencyLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	return c.limiter.roundTrip(c.next, req)
+}
+
+func (l *ConcurrencyLimiter) roundTrip(next http.RoundTripper, req *http.Request) (*http.Response, error) {
+	if err := l.sem.acquire(req.Context(), l.opts.MaxQueue, l.opts.MaxWait); err != nil {
+		return nil, err
+	}
+	if !l.opts.HoldUntilBodyClose {
+		defer l.sem.release()
+		return next.RoundTrip(req)
+	}
+
+	resp, err := next.RoundTrip(req)
+	if err != nil || resp.Body == nil || resp.Body == http.NoBody {
+		l.sem.release()
+		return resp, err
 	}
+	resp.Body = newSlotBody(req.Context(), resp.Body, l.sem.release)
+	return resp, nil
+}
 
-	sem := make(chan struct{}, limit)
+// slotBody releases a limiter slot exactly once, when the body is closed,
+// read to EOF, or its request context is done.
+type slotBody struct {
+	io.ReadCloser
+	once sync.Once
+	stop func() bool
+	done func()
+}
 
-	return func(next http.RoundTripper) http.RoundTripper {
-		return &concurrencyLimiter{next: next, sem: sem}
+func newSlotBody(ctx context.Context, body io.ReadCloser, release func()) *slotBody {
+	b := &slotBody{ReadCloser: body, done: release}
+	b.stop = context.AfterFunc(ctx, b.release)
+	return b
+}
+
+func (b *slotBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.finish()
 	}
+	return n, err
 }
 
-type concurrencyLimiter struct {
-	next http.RoundTripper
-	sem  chan struct{}
+func (b *slotBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.finish()
+	return err
 }
 
-func (c *concurrencyLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
-	// Acquire slot
-	c.sem <- struct{}{}
-	defer func() { <-c.sem }()
-	return c.next.RoundTrip(req)
+func (b *slotBody) finish() {
+	b.stop()
+	b.release()
+}
+
+func (b *slotBody) release() {
+	b.once.Do(b.done)
+}
+
+// semaphore is a FIFO counting semaphore whose waiters honor a context, a
+// queue bound and a maximum wait.
+type semaphore struct {
+	mu       sync.Mutex
+	limit    int
+	inFlight int
+	waiters  list.List
+	rejected uint64
+}
+
+func (s *semaphore) acquire(ctx context.Context, maxQueue int, maxWait time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.inFlight < s.limit && s.waiters.Len() == 0 {
+		s.inFlight++
+		s.mu.Unlock()
+		return nil
+	}
+	if maxQueue < 0 || (maxQueue > 0 && s.waiters.Len() >= maxQueue) {
+		s.rejected++
+		s.mu.Unlock()
+		return ErrLimiterQueueFull
+	}
+	ready := make(chan struct{})
+	elem := s.waiters.PushBack(ready)
+	s.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if maxWait > 0 {
+		timer := time.NewTimer(maxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var err error
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timeout:
+		err = ErrLimiterTimeout
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-ready:
+		// The slot was granted while giving up; hand it back.
+		s.inFlight--
+	default:
+		s.waiters.Remove(elem)
+	}
+	if err == ErrLimiterTimeout {
+		s.rejected++
+	}
+	s.notify()
+	return err
+}
+
+func (s *semaphore) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight--
+	s.notify()
+}
+
+// setLimit changes the limit, granting slots to waiters when it grows.
+// Requests in flight above a lowered limit finish normally.
+func (s *semaphore) setLimit(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit = limit
+	s.notify()
+}
+
+// notify grants free slots to waiters in FIFO order. s.mu must be held.
+func (s *semaphore) notify() {
+	for s.inFlight < s.limit && s.waiters.Len() > 0 {
+		ready := s.waiters.Remove(s.waiters.Front()).(chan struct{})
+		s.inFlight++
+		close(ready)
+	}
+}
+
+func (s *semaphore) stats() LimiterStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return LimiterStats{
+		Limit:    s.limit,
+		InFlight: s.inFlight,
+		Queued:   s.waiters.Len(),
+		Rejected: s.rejected,
+	}
 }
@@ -0,0 +1,137 @@
+package httptransport_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nativebpm/httpstream/internal/httprequest"
+	"github.com/nativebpm/httpstream/internal/httptransport"
+)
+
+// blockingTransport holds every round trip until release is closed.
+func blockingTransport(started chan<- struct{}, release <-chan struct{}) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		started <- struct{}{}
+		<-release
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	})
+}
+
+func TestConcurrencyLimiter_CancelledContext(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	defer close(release)
+
+	limiter := httptransport.NewConcurrencyLimiter(httptransport.ConcurrencyOptions{Limit: 1})
+	rt := limiter.Middleware()(blockingTransport(started, release))
+
+	go rt.RoundTrip(mustRequest(t, context.Background()))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := rt.RoundTrip(mustRequest(t, ctx))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context deadline exceeded, got %v", err)
+	}
+	if stats := limiter.Stats(); stats.InFlight != 1 || stats.Queued != 0 {
+		t.Errorf("unexpected stats after cancellation: %+v", stats)
+	}
+}
+
+func TestConcurrencyLimiter_QueueFullAndTimeout(t *testing.T) {
+	started, release := make(chan struct{}, 2), make(chan struct{})
+
+	limiter := httptransport.NewConcurrencyLimiter(httptransport.ConcurrencyOptions{
+		Limit:    1,
+		MaxQueue: 1,
+		MaxWait:  50 * time.Millisecond,
+	})
+	rt := limiter.Middleware()(blockingTransport(started, release))
+
+	go rt.RoundTrip(mustRequest(t, context.Background()))
+	<-started
+
+	queued := make(chan error, 1)
+	go func() {
+		_, err := rt.RoundTrip(mustRequest(t, context.Background()))
+		queued <- err
+	}()
+	waitFor(t, func() bool { return limiter.Stats().Queued == 1 })
+
+	if _, err := rt.RoundTrip(mustRequest(t, context.Background())); !errors.Is(err, httptransport.ErrLimiterQueueFull) {
+		t.Errorf("expected ErrLimiterQueueFull, got %v", err)
+	}
+	if err := <-queued; !errors.Is(err, httptransport.ErrLimiterTimeout) {
+		t.Errorf("expected ErrLimiterTimeout, got %v", err)
+	}
+
+	close(release)
+	waitFor(t, func() bool { return limiter.Stats().InFlight == 0 })
+
+	if stats := limiter.Stats(); stats.Rejected != 2 || stats.Limit != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func mustRequest(t *testing.T, ctx context.Context) *http.Request {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	return req
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConcurrencyLimiter_HoldUntilBodyClose(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("streamed body"))
+	}))
+	defer server.Close()
+
+	limiter := httptransport.NewConcurrencyLimiter(httptransport.ConcurrencyOptions{
+		Limit:              1,
+		MaxQueue:           -1,
+		HoldUntilBodyClose: true,
+	})
+
+	resp, err := httprequest.NewRequest(context.Background(), http.Client{}, http.MethodGet, server.URL).
+		Use(limiter.Middleware()).
+		Timeout(time.Second).
+		Send()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats := limiter.Stats(); stats.InFlight != 1 {
+		t.Errorf("expected slot held while body is open, got %+v", stats)
+	}
+
+	_, err = httprequest.NewRequest(context.Background(), http.Client{}, http.MethodGet, server.URL).
+		Use(limiter.Middleware()).
+		Send()
+	if !errors.Is(err, httptransport.ErrLimiterQueueFull) {
+		t.Errorf("expected ErrLimiterQueueFull while body is open, got %v", err)
+	}
+
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if stats := limiter.Stats(); stats.InFlight != 0 {
+		t.Errorf("expected slot released after close, got %+v", stats)
+	}
+}
@@ -0,0 +1,236 @@
+package httptransport
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitOptions configures RateLimitMiddleware.
+type RateLimitOptions struct {
+	// RequestsPerSecond is the sustained rate at which requests may start.
+	// Zero disables request rate limiting.
+	RequestsPerSecond float64
+
+	// Burst is the number of requests that may start back to back.
+	// Defaults to 1.
+	Burst int
+
+	// BytesPerSecond limits the rate at which request and response bodies are
+	// streamed, shared by all requests. Zero disables byte rate limiting.
+	BytesPerSecond float64
+
+	// ByteBurst is the number of bytes that may be transferred back to back.
+	// Defaults to 32 KiB.
+	ByteBurst int
+
+	// AdaptToHeaders makes the limiter read RateLimit-Remaining and
+	// RateLimit-Reset (or X-RateLimit-Remaining and X-RateLimit-Reset) from
+	// responses. Requests are paused until the reset when no quota remains,
+	// and otherwise spread over the remaining window.
+	AdaptToHeaders bool
+}
+
+// RateLimitMiddleware returns a Middleware that throttles requests with a
+// token bucket shared by every RoundTripper it produces. Waiting honors the
+// request context.
+func RateLimitMiddleware(opts RateLimitOptions) func(http.RoundTripper) http.RoundTripper {
+	if opts.Burst <= 0 {
+		opts.Burst = 1
+	}
+	if opts.ByteBurst <= 0 {
+		opts.ByteBurst = 32 << 10
+	}
+
+	requests := newTokenBucket(opts.RequestsPerSecond, opts.Burst)
+	var bytes *tokenBucket
+	if opts.BytesPerSecond > 0 {
+		bytes = newTokenBucket(opts.BytesPerSecond, opts.ByteBurst)
+	}
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return &rateLimiter{next: next, opts: opts, requests: requests, bytes: bytes}
+	}
+}
+
+type rateLimiter struct {
+	next     http.RoundTripper
+	opts     RateLimitOptions
+	requests *tokenBucket
+	bytes    *tokenBucket
+}
+
+func (r *rateLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if err := r.requests.wait(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	if r.bytes != nil && req.Body != nil && req.Body != http.NoBody {
+		body := &throttledReader{ReadCloser: req.Body, ctx: ctx, bucket: r.bytes}
+		req = req.Clone(ctx)
+		req.Body = body
+	}
+
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	if r.opts.AdaptToHeaders {
+		r.requests.adapt(resp.Header, time.Now())
+	}
+	if r.bytes != nil && resp.Body != nil && resp.Body != http.NoBody {
+		resp.Body = &throttledReader{ReadCloser: resp.Body, ctx: ctx, bucket: r.bytes}
+	}
+	return resp, nil
+}
+
+// tokenBucket is a token bucket refilled at rate tokens per second up to
+// burst tokens. A zero rate means unlimited, subject only to header-driven
+// pauses and caps.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	// Header-driven adaptation.
+	pausedUntil time.Time
+	capRate     float64
+	capUntil    time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// wait takes n tokens, sleeping until they are available or ctx is done.
+func (b *tokenBucket) wait(ctx context.Context, n float64) error {
+	delay := b.reserve(n, time.Now())
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		b.cancel(n)
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// reserve takes n tokens, possibly going into debt, and returns how long the
+// caller has to wait before the tokens are covered.
+func (b *tokenBucket) reserve(n float64, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var delay time.Duration
+	if rate := b.effectiveRate(now); rate > 0 {
+		if !b.last.IsZero() {
+			b.tokens += now.Sub(b.last).Seconds() * rate
+			if b.tokens > b.burst {
+				b.tokens = b.burst
+			}
+		}
+		b.tokens -= n
+		if b.tokens < 0 {
+			delay = time.Duration(-b.tokens / rate * float64(time.Second))
+		}
+	}
+	b.last = now
+
+	if pause := b.pausedUntil.Sub(now); pause > delay {
+		delay = pause
+	}
+	return delay
+}
+
+func (b *tokenBucket) cancel(n float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rate > 0 || b.capRate > 0 {
+		b.tokens += n
+	}
+}
+
+func (b *tokenBucket) effectiveRate(now time.Time) float64 {
+	rate := b.rate
+	if now.Before(b.capUntil) && (rate == 0 || b.capRate < rate) {
+		rate = b.capRate
+	}
+	return rate
+}
+
+// adapt reads rate limit headers of a response: it pauses the bucket until
+// the reset when no quota remains and otherwise caps the rate so the
+// remaining quota lasts until the reset.
+func (b *tokenBucket) adapt(header http.Header, now time.Time) {
+	remaining, ok := headerInt(header, "RateLimit-Remaining", "X-RateLimit-Remaining")
+	if !ok {
+		return
+	}
+	reset, ok := headerInt(header, "RateLimit-Reset", "X-RateLimit-Reset")
+	if !ok || reset <= 0 {
+		return
+	}
+
+	// X-RateLimit-Reset is commonly a Unix timestamp rather than seconds.
+	var until time.Time
+	if reset > 1_000_000_000 {
+		until = time.Unix(reset, 0)
+	} else {
+		until = now.Add(time.Duration(reset) * time.Second)
+	}
+	window := until.Sub(now)
+	if window <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if remaining <= 0 {
+		b.pausedUntil = until
+		return
+	}
+	b.capRate = float64(remaining) / window.Seconds()
+	b.capUntil = until
+}
+
+func headerInt(header http.Header, keys ...string) (int64, bool) {
+	for _, key := range keys {
+		if value := header.Get(key); value != "" {
+			n, err := strconv.ParseInt(value, 10, 64)
+			return n, err == nil
+		}
+	}
+	return 0, false
+}
+
+// throttledReader takes one token per byte read from a shared bucket.
+type throttledReader struct {
+	io.ReadCloser
+	ctx    context.Context
+	bucket *tokenBucket
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if burst := int(t.bucket.burst); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		if werr := t.bucket.wait(t.ctx, float64(n)); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
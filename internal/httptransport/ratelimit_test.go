@@ -0,0 +1,109 @@
+package httptransport_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nativebpm/httpstream/internal/httprequest"
+	"github.com/nativebpm/httpstream/internal/httptransport"
+)
+
+func TestRateLimitMiddleware_Requests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	limit := httptransport.RateLimitMiddleware(httptransport.RateLimitOptions{RequestsPerSecond: 20, Burst: 1})
+	client := &http.Client{Transport: limit(http.DefaultTransport)}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("expected requests to be spaced by 50ms, took %v", elapsed)
+	}
+}
+
+func TestRateLimitMiddleware_ContextCancellation(t *testing.T) {
+	limit := httptransport.RateLimitMiddleware(httptransport.RateLimitOptions{RequestsPerSecond: 0.1, Burst: 1})
+	rt := limit(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	}))
+
+	if _, err := rt.RoundTrip(mustRequest(t, context.Background())); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := rt.RoundTrip(mustRequest(t, ctx)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context deadline exceeded, got %v", err)
+	}
+}
+
+func TestRateLimitMiddleware_AdaptsToHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("RateLimit-Remaining", "0")
+		w.Header().Set("RateLimit-Reset", "1")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	limit := httptransport.RateLimitMiddleware(httptransport.RateLimitOptions{AdaptToHeaders: true})
+	client := &http.Client{Transport: limit(http.DefaultTransport)}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = httprequest.NewRequest(ctx, http.Client{}, http.MethodGet, server.URL).Use(limit).Send()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected request to wait for the reset, got %v", err)
+	}
+}
+
+func TestRateLimitMiddleware_Bytes(t *testing.T) {
+	payload := strings.Repeat("x", 4096)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte(payload))
+	}))
+	defer server.Close()
+
+	limit := httptransport.RateLimitMiddleware(httptransport.RateLimitOptions{BytesPerSecond: 40960, ByteBurst: 1024})
+
+	start := time.Now()
+	resp, err := httprequest.NewRequest(context.Background(), http.Client{}, http.MethodPost, server.URL).
+		Body(io.NopCloser(strings.NewReader(payload)), "text/plain").
+		Use(limit).
+		Send()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if len(body) != len(payload) {
+		t.Errorf("expected %d bytes, got %d", len(payload), len(body))
+	}
+	// 8 KiB at 40 KiB/s with a 1 KiB burst takes about 175ms.
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("expected bodies to be throttled, took %v", elapsed)
+	}
+}
@@ -0,0 +1,279 @@
+package httptransport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nativebpm/httpstream/internal/httpbody"
+)
+
+var (
+	// ErrBodyNotReplayable reports that a retry was skipped because the request
+	// body was already (partially) streamed and the request has no GetBody.
+	ErrBodyNotReplayable = errors.New("httpstream: request body was consumed and cannot be replayed")
+
+	// ErrRetryBudgetExhausted reports that a retry was skipped because the
+	// maximum number of attempts or the maximum elapsed time was reached.
+	ErrRetryBudgetExhausted = errors.New("httpstream: retry budget exhausted")
+)
+
+// RetryError is returned by RetryMiddleware when a failed round trip was
+// retryable but no further attempt was made. Reason is one of
+// ErrBodyNotReplayable or ErrRetryBudgetExhausted and Err is the error of
+// the last attempt. Both can be matched with errors.Is and errors.As.
+type RetryError struct {
+	Attempts int
+	Reason   error
+	Err      error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("retry skipped after %d attempt(s): %v: %v", e.Attempts, e.Reason, e.Err)
+}
+
+func (e *RetryError) Unwrap() []error {
+	return []error{e.Reason, e.Err}
+}
+
+// RetryOptions configures RetryMiddleware. Zero values select the defaults
+// documented on each field.
+type RetryOptions struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	// Defaults to 3.
+	MaxAttempts int
+
+	// MaxElapsed bounds the time spent on all attempts and backoff delays,
+	// measured from the first attempt. Zero means no limit.
+	MaxElapsed time.Duration
+
+	// BaseDelay is the backoff ceiling for the first retry. Defaults to 100ms.
+	BaseDelay time.Duration
+
+	// MaxDelay caps the backoff ceiling of a single retry. It does not cap a
+	// delay requested by the server through Retry-After. Defaults to 10s.
+	MaxDelay time.Duration
+
+	// Multiplier grows the backoff ceiling after each attempt. Defaults to 2.
+	Multiplier float64
+
+	// ShouldRetry reports whether the outcome of an attempt is retryable.
+	// Defaults to DefaultShouldRetry.
+	ShouldRetry func(resp *http.Response, err error) bool
+
+	// OnSkip, when set, is called with the reason whenever a retryable
+	// attempt is not retried.
+	OnSkip func(req *http.Request, reason error)
+}
+
+// DefaultShouldRetry retries transport errors that are not caused by the
+// request context, and responses with status 429, 502, 503 or 504.
+func DefaultShouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// RetryMiddleware returns a Middleware that retries failed round trips with
+// exponential backoff and full jitter, honoring Retry-After on 429 and 503
+// responses.
+//
+// Streamed bodies produced by an io.Pipe cannot be re-read, so a request is
+// only retried when it has no body, when req.GetBody is set, or when the
+// transport never read from the body. Otherwise the retry is skipped and the
+// reason is reported through OnSkip and, for transport errors, a *RetryError.
+func RetryMiddleware(opts RetryOptions) func(http.RoundTripper) http.RoundTripper {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 3
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = 100 * time.Millisecond
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = 10 * time.Second
+	}
+	if opts.Multiplier < 1 {
+		opts.Multiplier = 2
+	}
+	if opts.ShouldRetry == nil {
+		opts.ShouldRetry = DefaultShouldRetry
+	}
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return &retryRoundTripper{next: next, opts: opts}
+	}
+}
+
+type retryRoundTripper struct {
+	next http.RoundTripper
+	opts RetryOptions
+}
+
+func (r *retryRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	start := time.Now()
+
+	// Bodies without GetBody are guarded so that a Close issued by the
+	// transport before anything was read does not destroy the stream.
+	var guard *replayGuard
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		guard = &replayGuard{ReadCloser: req.Body}
+		req = req.Clone(ctx)
+		req.Body = guard
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := r.next.RoundTrip(req)
+		if ctx.Err() != nil || !r.opts.ShouldRetry(resp, err) {
+			guard.release()
+			return resp, err
+		}
+
+		delay := r.backoff(attempt, resp)
+		if reason := r.skipReason(attempt, start, delay, req, guard); reason != nil {
+			guard.release()
+			if r.opts.OnSkip != nil {
+				r.opts.OnSkip(req, reason)
+			}
+			if err != nil {
+				return nil, &RetryError{Attempts: attempt, Reason: reason, Err: err}
+			}
+			return resp, nil
+		}
+
+		if resp != nil {
+			httpbody.DrainAndClose(resp.Body)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			guard.release()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+	}
+}
+
+func (r *retryRoundTripper) skipReason(attempt int, start time.Time, delay time.Duration, req *http.Request, guard *replayGuard) error {
+	if attempt >= r.opts.MaxAttempts {
+		return ErrRetryBudgetExhausted
+	}
+	if r.opts.MaxElapsed > 0 && time.Since(start)+delay > r.opts.MaxElapsed {
+		return ErrRetryBudgetExhausted
+	}
+	if guard != nil && guard.consumed() {
+		return ErrBodyNotReplayable
+	}
+	return nil
+}
+
+// backoff returns the delay before the next attempt: a full-jitter
+// exponential backoff, raised to the server's Retry-After when present.
+func (r *retryRoundTripper) backoff(attempt int, resp *http.Response) time.Duration {
+	ceiling := float64(r.opts.BaseDelay) * math.Pow(r.opts.Multiplier, float64(attempt-1))
+	if ceiling > float64(r.opts.MaxDelay) {
+		ceiling = float64(r.opts.MaxDelay)
+	}
+	delay := time.Duration(rand.Int63n(int64(ceiling) + 1))
+
+	if resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		if after, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok && after > delay {
+			delay = after
+		}
+	}
+	return delay
+}
+
+// parseRetryAfter parses a Retry-After header value given either as
+// delay-seconds or as an HTTP-date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := at.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// replayGuard wraps a non-rewindable request body. As long as nothing has
+// been read, Close requests are deferred so the body can be sent again.
+type replayGuard struct {
+	io.ReadCloser
+	mu       sync.Mutex
+	read     bool
+	released bool
+	closing  bool
+}
+
+func (g *replayGuard) Read(p []byte) (int, error) {
+	n, err := g.ReadCloser.Read(p)
+	if n > 0 || err != nil {
+		g.mu.Lock()
+		g.read = true
+		g.mu.Unlock()
+	}
+	return n, err
+}
+
+func (g *replayGuard) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.read || g.released {
+		return g.ReadCloser.Close()
+	}
+	g.closing = true
+	return nil
+}
+
+func (g *replayGuard) consumed() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.read
+}
+
+// release stops deferring Close and performs any Close that was deferred.
+func (g *replayGuard) release() {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.released = true
+	if g.closing && !g.read {
+		_ = g.ReadCloser.Close()
+	}
+}
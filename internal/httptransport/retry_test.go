@@ -0,0 +1,134 @@
+package httptransport_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nativebpm/httpstream/internal/httprequest"
+	"github.com/nativebpm/httpstream/internal/httptransport"
+)
+
+func TestRetryMiddleware_RetriesUntilSuccess(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	resp, err := httprequest.NewRequest(context.Background(), http.Client{}, http.MethodGet, server.URL).
+		Use(httptransport.RetryMiddleware(httptransport.RetryOptions{BaseDelay: time.Millisecond})).
+		Send()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200, got %d", resp.StatusCode)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls.Load())
+	}
+}
+
+func TestRetryMiddleware_ReplaysGetBody(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("payload"))
+	client := &http.Client{Transport: httptransport.RetryMiddleware(httptransport.RetryOptions{BaseDelay: time.Millisecond})(http.DefaultTransport)}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if len(bodies) != 2 || bodies[0] != "payload" || bodies[1] != "payload" {
+		t.Errorf("expected body to be sent twice, got %q", bodies)
+	}
+}
+
+func TestRetryMiddleware_SkipsConsumedStream(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	var skipped error
+	retry := httptransport.RetryMiddleware(httptransport.RetryOptions{
+		BaseDelay: time.Millisecond,
+		OnSkip:    func(_ *http.Request, reason error) { skipped = reason },
+	})
+
+	resp, err := httprequest.NewRequest(context.Background(), http.Client{}, http.MethodPost, server.URL).
+		JSON(map[string]string{"key": "value"}).
+		Use(retry).
+		Send()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503, got %d", resp.StatusCode)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected 1 attempt, got %d", calls.Load())
+	}
+	if !errors.Is(skipped, httptransport.ErrBodyNotReplayable) {
+		t.Errorf("expected ErrBodyNotReplayable, got %v", skipped)
+	}
+}
+
+func TestRetryMiddleware_TransportErrorBudget(t *testing.T) {
+	var calls atomic.Int32
+	failing := roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		calls.Add(1)
+		return nil, errors.New("connection reset")
+	})
+
+	rt := httptransport.RetryMiddleware(httptransport.RetryOptions{MaxAttempts: 2, BaseDelay: time.Millisecond})(failing)
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	_, err := rt.RoundTrip(req)
+
+	var retryErr *httptransport.RetryError
+	if !errors.As(err, &retryErr) {
+		t.Fatalf("expected *RetryError, got %v", err)
+	}
+	if retryErr.Attempts != 2 || calls.Load() != 2 {
+		t.Errorf("expected 2 attempts, got %d (calls %d)", retryErr.Attempts, calls.Load())
+	}
+	if !errors.Is(err, httptransport.ErrRetryBudgetExhausted) {
+		t.Errorf("expected ErrRetryBudgetExhausted, got %v", err)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -4,9 +4,83 @@ import (
 	"log/slog"
 	"net/http"
 
+	"github.com/nativebpm/httpstream/internal/httpcompress"
 	"github.com/nativebpm/httpstream/internal/httptransport"
 )
 
+// ConcurrencyOptions configures a ConcurrencyLimiter.
+type ConcurrencyOptions = httptransport.ConcurrencyOptions
+
+// ConcurrencyLimiter limits concurrent requests and reports its state.
+type ConcurrencyLimiter = httptransport.ConcurrencyLimiter
+
+// LimiterStats is a point-in-time snapshot of a limiter.
+type LimiterStats = httptransport.LimiterStats
+
+// BulkheadOptions configures a Bulkhead.
+type BulkheadOptions = httptransport.BulkheadOptions
+
+// Bulkhead isolates requests into compartments with their own limits.
+type Bulkhead = httptransport.Bulkhead
+
+// AdaptiveOptions configures an AdaptiveLimiter.
+type AdaptiveOptions = httptransport.AdaptiveOptions
+
+// AdaptiveLimiter adjusts its concurrency limit from observed latency and drops.
+type AdaptiveLimiter = httptransport.AdaptiveLimiter
+
+// LimitAlgorithm computes the next limit of an AdaptiveLimiter.
+type LimitAlgorithm = httptransport.LimitAlgorithm
+
+// LimitSample describes one request observed by an AdaptiveLimiter.
+type LimitSample = httptransport.LimitSample
+
+// AIMD is an additive-increase/multiplicative-decrease LimitAlgorithm.
+type AIMD = httptransport.AIMD
+
+// Gradient is a Vegas-style latency gradient LimitAlgorithm.
+type Gradient = httptransport.Gradient
+
+// RateLimitOptions configures RateLimitMiddleware.
+type RateLimitOptions = httptransport.RateLimitOptions
+
+// CircuitBreakerOptions configures a CircuitBreaker.
+type CircuitBreakerOptions = httptransport.CircuitBreakerOptions
+
+// CircuitBreaker stops sending requests to upstreams that keep failing.
+type CircuitBreaker = httptransport.CircuitBreaker
+
+// CircuitState is the state of a circuit.
+type CircuitState = httptransport.CircuitState
+
+const (
+	CircuitClosed   = httptransport.CircuitClosed
+	CircuitOpen     = httptransport.CircuitOpen
+	CircuitHalfOpen = httptransport.CircuitHalfOpen
+)
+
+// RetryOptions configures RetryMiddleware.
+type RetryOptions = httptransport.RetryOptions
+
+// RetryError reports why a retryable round trip was not retried.
+type RetryError = httptransport.RetryError
+
+// CompressionOptions configures CompressionMiddleware.
+type CompressionOptions = httptransport.CompressionOptions
+
+// DecompressionOptions configures DecompressionMiddleware.
+type DecompressionOptions = httptransport.DecompressionOptions
+
+var (
+	ErrLimiterQueueFull     = httptransport.ErrLimiterQueueFull
+	ErrLimiterTimeout       = httptransport.ErrLimiterTimeout
+	ErrCircuitOpen          = httptransport.ErrCircuitOpen
+	ErrBodyNotReplayable    = httptransport.ErrBodyNotReplayable
+	ErrRetryBudgetExhausted = httptransport.ErrRetryBudgetExhausted
+	ErrUnsupportedEncoding  = httpcompress.ErrUnsupportedEncoding
+	ErrDecompressionLimit   = httptransport.ErrDecompressionLimit
+)
+
 func LoggingMiddleware(logger *slog.Logger) func(http.RoundTripper) http.RoundTripper {
 	return httptransport.LoggingMiddleware(logger)
 }
@@ -17,3 +91,71 @@ func LoggingMiddleware(logger *slog.Logger) func(http.RoundTripper) http.RoundTr
 func ConcurrencyMiddleware(limit int) func(http.RoundTripper) http.RoundTripper {
 	return httptransport.ConcurrencyMiddleware(limit)
 }
+
+// NewConcurrencyLimiter creates a limiter whose Middleware bounds in-flight
+// requests, queue length and queue wait, and whose Stats expose back-pressure.
+func NewConcurrencyLimiter(opts ConcurrencyOptions) *ConcurrencyLimiter {
+	return httptransport.NewConcurrencyLimiter(opts)
+}
+
+// NewBulkhead creates a Bulkhead that limits concurrency per host, per route
+// template or per custom key, as selected by BulkheadOptions.Key.
+func NewBulkhead(opts BulkheadOptions) *Bulkhead {
+	return httptransport.NewBulkhead(opts)
+}
+
+// ByHost is a bulkhead key function partitioning requests by host.
+func ByHost(req *http.Request) string {
+	return httptransport.ByHost(req)
+}
+
+// ByRoute is a bulkhead key function partitioning requests by method and the
+// unexpanded path passed to Client.Request, e.g. "GET /users/{id}".
+func ByRoute(req *http.Request) string {
+	return httptransport.ByRoute(req)
+}
+
+// NewAdaptiveLimiter creates a limiter that grows its limit while latency is
+// stable and shrinks it on timeouts, 429s and 503s.
+func NewAdaptiveLimiter(opts AdaptiveOptions) *AdaptiveLimiter {
+	return httptransport.NewAdaptiveLimiter(opts)
+}
+
+// RateLimitMiddleware returns a Middleware that throttles requests and,
+// optionally, body bytes with token buckets, adapting to rate limit headers
+// when configured.
+func RateLimitMiddleware(opts RateLimitOptions) func(http.RoundTripper) http.RoundTripper {
+	return httptransport.RateLimitMiddleware(opts)
+}
+
+// NewCircuitBreaker creates a CircuitBreaker with one circuit per host, or
+// per key as selected by CircuitBreakerOptions.Key.
+func NewCircuitBreaker(opts CircuitBreakerOptions) *CircuitBreaker {
+	return httptransport.NewCircuitBreaker(opts)
+}
+
+// LogCircuitStateChanges returns a CircuitBreakerOptions.OnStateChange
+// callback that logs through logger, like LoggingMiddleware.
+func LogCircuitStateChanges(logger *slog.Logger) func(key string, from, to CircuitState) {
+	return httptransport.LogCircuitStateChanges(logger)
+}
+
+// RetryMiddleware returns a Middleware that retries failed round trips with
+// exponential backoff and full jitter, honoring Retry-After. Streamed bodies
+// are only retried when they can be replayed; see RetryOptions.
+func RetryMiddleware(opts RetryOptions) func(http.RoundTripper) http.RoundTripper {
+	return httptransport.RetryMiddleware(opts)
+}
+
+// CompressionMiddleware returns a Middleware that streams request bodies
+// through a gzip, deflate or custom encoder and sets Content-Encoding.
+func CompressionMiddleware(opts CompressionOptions) func(http.RoundTripper) http.RoundTripper {
+	return httptransport.CompressionMiddleware(opts)
+}
+
+// DecompressionMiddleware returns a Middleware that requests and decodes
+// gzip, deflate and custom content codings, limiting the decompressed size
+// and expansion ratio of response bodies.
+func DecompressionMiddleware(opts DecompressionOptions) func(http.RoundTripper) http.RoundTripper {
+	return httptransport.DecompressionMiddleware(opts)
+}
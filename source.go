@@ -0,0 +1,26 @@
+package httpstream
+
+import "github.com/nativebpm/httpstream/internal/httprequest"
+
+// Source produces the values of a streamed request body, such as the
+// records of Request.JSONLines.
+type Source = httprequest.Source
+
+// FromChan returns a Source that yields the values received from ch until
+// it is closed.
+func FromChan[T any](ch <-chan T) Source {
+	return httprequest.FromChan(ch)
+}
+
+// FromSeq returns a Source that yields the values of a push iterator, such
+// as an iter.Seq[T].
+func FromSeq[T any](seq func(yield func(T) bool)) Source {
+	return httprequest.FromSeq(seq)
+}
+
+// FromSeq2 returns a Source that yields the values of a push iterator of
+// values and errors, such as an iter.Seq2[T, error]. The first error aborts
+// the request.
+func FromSeq2[T any](seq func(yield func(T, error) bool)) Source {
+	return httprequest.FromSeq2(seq)
+}